@@ -2,32 +2,107 @@ package main
 
 import (
 	"context"
+	"github.com/redis/go-redis/v9"
 	"kod/internal/api"
 	"kod/internal/handler"
+	"kod/internal/mail"
 	"kod/internal/middleware"
+	"kod/internal/models/config"
 	"kod/internal/service"
+	"kod/internal/speller"
+	"kod/internal/storage/cached"
 	"kod/internal/storage/postgres"
 	"kod/internal/util"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 func main() {
 	ctx := context.Background()
-	zapLogger := util.NewZapLogger()
+	zapLogger := util.NewZapLogger(util.NewLogConfig())
 	dbConfig := util.NewDbConfig()
 	httpCfg := util.NewHttpConfig()
 	sesConfig := util.NewSessionConfig()
+	telemetryCfg := util.NewTelemetryConfig()
+	corsCfg := util.NewCorsConfig()
+	mailCfg := util.NewMailConfig()
+	accountCfg := util.NewAccountConfig()
+	oidcCfg := util.NewOidcConfig()
+	spellerCfg := util.NewSpellerConfig()
+	dictionaryCfg := util.NewDictionaryConfig()
+	validationCfg := util.NewValidationConfig()
+	storageCacheCfg := util.NewStorageCacheConfig()
 
 	storage := postgres.NewPostgresRepository(ctx, dbConfig, zapLogger)
+	switch storageCacheCfg.Backend {
+	case config.CacheMemory:
+		storage = cached.New(storage, cached.NewMemory(storageCacheCfg.Size, storageCacheCfg.TTL), zapLogger)
+	case config.CacheRedis:
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     storageCacheCfg.RedisAddr,
+			Password: storageCacheCfg.RedisPassword,
+			DB:       storageCacheCfg.RedisDB,
+		})
+		storage = cached.New(storage, cached.NewRedis(redisClient, storageCacheCfg.TTL), zapLogger)
+	}
 
-	noteService := service.NewNoteService(storage)
+	mailer, err := mail.NewMailer(mailCfg, zapLogger)
+	if err != nil {
+		zapLogger.Fatalln(err)
+	}
+
+	spellerClient := speller.NewClient(spellerCfg)
+	var checker speller.Checker = spellerClient
+	if spellerCfg.CacheSize > 0 {
+		checker = speller.NewCachedClient(spellerClient, spellerCfg)
+	}
+	// Offline results aren't cached, the speller rechecks the texts once it's back
+	if spellerCfg.OfflineFallback {
+		checker = speller.NewFallback(checker, speller.NewOffline())
+	}
+
+	dictionaryService, err := service.NewDictionaryService(storage, dictionaryCfg)
+	if err != nil {
+		zapLogger.Fatalln(err)
+	}
+
+	validators, err := service.NewNoteValidators(validationCfg, checker, dictionaryService, spellerCfg, zapLogger)
+	if err != nil {
+		zapLogger.Fatalln(err)
+	}
+
+	noteService := service.NewNoteService(storage, service.NewNotePipeline(validationCfg.Policy, validators...), zapLogger)
 	sessionService := service.NewSessionService(sesConfig)
-	userService := service.NewUserService(storage, sessionService)
+	mfaService := service.NewMfaService(storage, accountCfg)
+	userService := service.NewUserService(storage, sessionService, mfaService)
+	passwordService := service.NewPasswordService(storage, mailer, accountCfg, zapLogger)
+	adminService := service.NewAdminService(storage)
+	profileService := service.NewProfileService(storage, sessionService, mailer, accountCfg, zapLogger)
 
-	middlewareService := middleware.NewMiddleware(sessionService, zapLogger)
+	apiTokenService := service.NewApiTokenService(storage)
+	oidcService := service.NewOidcService(storage, sessionService, oidcCfg)
 
-	handlerController := handler.NewHandler(noteService, userService, zapLogger)
+	middlewareService := middleware.NewMiddleware(sessionService, userService, apiTokenService, zapLogger)
 
-	app := api.NewAPI(handlerController, middlewareService, zapLogger, httpCfg)
+	handlerController := handler.NewHandler(noteService, userService, passwordService, profileService, mfaService, adminService, apiTokenService, oidcService, dictionaryService, zapLogger)
+
+	app := api.NewAPI(handlerController, middlewareService, zapLogger, httpCfg, telemetryCfg, corsCfg)
+
+	// Workers stop together with the server and finish their current jobs before exit
+	workerCtx, stopWorkers := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	var workers sync.WaitGroup
+	if spellerCfg.CheckMode == config.CheckAsync {
+		grammarWorker := service.NewGrammarWorker(storage, checker, dictionaryService, spellerCfg, zapLogger)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			grammarWorker.Run(workerCtx)
+		}()
+	}
 
 	app.Run(ctx)
+
+	stopWorkers()
+	workers.Wait()
 }
\ No newline at end of file
@@ -8,6 +8,7 @@ import (
 	"go.uber.org/zap"
 	"kod/internal/handler"
 	"kod/internal/middleware"
+	"kod/internal/models"
 	"kod/internal/models/config"
 	"kod/telemetry"
 	"net/http"
@@ -26,9 +27,11 @@ type API struct {
 	middleware    *middleware.Middleware
 	zapLogger     *zap.SugaredLogger
 	telemetryAddr string
+	telemetryCfg  *config.TelemetryConfig
+	corsCfg       *config.CorsConfig
 }
 
-func NewAPI(c *handler.Handler, m *middleware.Middleware, l *zap.SugaredLogger, hc *config.HttpConfig) *API {
+func NewAPI(c *handler.Handler, m *middleware.Middleware, l *zap.SugaredLogger, hc *config.HttpConfig, tc *config.TelemetryConfig, cc *config.CorsConfig) *API {
 	return &API{
 		server: &http.Server{
 			Addr:         fmt.Sprintf("%s:%s", hc.Host, hc.Port),
@@ -40,6 +43,8 @@ func NewAPI(c *handler.Handler, m *middleware.Middleware, l *zap.SugaredLogger,
 		middleware:    m,
 		zapLogger:     l,
 		telemetryAddr: hc.TelemetryAddr,
+		telemetryCfg:  tc,
+		corsCfg:       cc,
 	}
 }
 
@@ -47,19 +52,68 @@ func (a *API) Run(ctxBackground context.Context) {
 	ctx, stop := signal.NotifyContext(ctxBackground, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	shutdownTracing, err := telemetry.Setup(ctx, a.telemetryCfg)
+	if err != nil {
+		a.zapLogger.Errorf("tracing disabled: %v", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
 	go telemetry.Listen(ctx, a.zapLogger, a.telemetryAddr)
 
 	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(a.controller.HandleNotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(a.controller.HandleMethodNotAllowed)
+	router.Use(a.middleware.Tracing)
+	router.Use(a.middleware.RequestId)
+	router.Use(a.middleware.AccessLog)
 	router.HandleFunc("/signup", a.controller.HandleSignUp).Methods("POST")
 	router.HandleFunc("/login", a.controller.HandleLogIn).Methods("POST")
-	router.HandleFunc("/logout", a.controller.HandleLogOut).Methods("GET")
+	router.HandleFunc("/login/mfa", a.controller.HandleLogInMfa).Methods("POST")
+	router.Handle("/logout", a.middleware.Csrf(http.HandlerFunc(a.controller.HandleLogOut))).Methods("POST")
+	router.HandleFunc("/password/forgot", a.controller.HandleForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", a.controller.HandleResetPassword).Methods("POST")
+	router.HandleFunc("/email/verify", a.controller.HandleVerifyEmail).Methods("GET")
+	router.HandleFunc("/auth/oidc/{provider}/login", a.controller.HandleOidcLogin).Methods("GET")
+	router.HandleFunc("/auth/oidc/{provider}/callback", a.controller.HandleOidcCallback).Methods("GET")
 	router.Use(a.middleware.RateLimit)
 
 	authRouter := router.PathPrefix("/notes").Subrouter()
-	authRouter.Use(a.middleware.AuthMiddleware)
+	authRouter.Use(a.middleware.ApiAuthMiddleware, a.middleware.Csrf)
 	authRouter.HandleFunc("/get", a.controller.HandleGetNotes).Methods("GET")
 	authRouter.HandleFunc("/add", a.controller.HandleAddNote).Methods("POST")
-	a.server.Handler = router
+
+	accountRouter := router.PathPrefix("/account").Subrouter()
+	accountRouter.Use(a.middleware.AuthMiddleware, a.middleware.Csrf)
+	accountRouter.HandleFunc("", a.controller.HandleGetAccount).Methods("GET")
+	accountRouter.HandleFunc("", a.controller.HandleUpdateAccount).Methods("PATCH")
+	accountRouter.HandleFunc("", a.controller.HandleDeleteAccount).Methods("DELETE")
+	accountRouter.HandleFunc("/password", a.controller.HandleChangePassword).Methods("POST")
+	accountRouter.HandleFunc("/email/verification", a.controller.HandleResendVerification).Methods("POST")
+	accountRouter.HandleFunc("/mfa/totp", a.controller.HandleEnrollTotp).Methods("POST")
+	accountRouter.HandleFunc("/mfa/totp/confirm", a.controller.HandleConfirmTotp).Methods("POST")
+	accountRouter.HandleFunc("/mfa/totp", a.controller.HandleDisableTotp).Methods("DELETE")
+	accountRouter.HandleFunc("/tokens", a.controller.HandleListApiTokens).Methods("GET")
+	accountRouter.HandleFunc("/tokens", a.controller.HandleCreateApiToken).Methods("POST")
+	accountRouter.HandleFunc("/tokens/{id:[0-9]+}", a.controller.HandleDeleteApiToken).Methods("DELETE")
+
+	dictionaryRouter := router.PathPrefix("/dictionary").Subrouter()
+	dictionaryRouter.Use(a.middleware.AuthMiddleware, a.middleware.Csrf)
+	dictionaryRouter.HandleFunc("", a.controller.HandleListDictionary).Methods("GET")
+	dictionaryRouter.HandleFunc("", a.controller.HandleAddDictionaryWord).Methods("POST")
+	dictionaryRouter.HandleFunc("/{id:[0-9]+}", a.controller.HandleDeleteDictionaryWord).Methods("DELETE")
+
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(a.middleware.AuthMiddleware, a.middleware.Csrf, a.middleware.RequireRole(models.RoleAdmin))
+	adminRouter.HandleFunc("/users", a.controller.HandleListUsers).Methods("GET")
+	adminRouter.HandleFunc("/users/{id:[0-9]+}", a.controller.HandleGetUser).Methods("GET")
+	adminRouter.HandleFunc("/users/{id:[0-9]+}/disable", a.controller.HandleDisableUser).Methods("POST")
+	adminRouter.HandleFunc("/users/{id:[0-9]+}/enable", a.controller.HandleEnableUser).Methods("POST")
+	adminRouter.HandleFunc("/users/{id:[0-9]+}/role", a.controller.HandleSetUserRole).Methods("PUT")
+	adminRouter.HandleFunc("/users/{id:[0-9]+}/logout", a.controller.HandleForceLogOut).Methods("POST")
+	adminRouter.HandleFunc("/dictionary", a.controller.HandleListOrgDictionary).Methods("GET")
+	adminRouter.HandleFunc("/dictionary", a.controller.HandleAddOrgDictionaryWord).Methods("POST")
+	adminRouter.HandleFunc("/dictionary/{id:[0-9]+}", a.controller.HandleDeleteOrgDictionaryWord).Methods("DELETE")
+	a.server.Handler = a.middleware.Cors(a.corsCfg)(router)
 
 	go func() {
 		if err := a.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -77,6 +131,9 @@ func (a *API) Run(ctxBackground context.Context) {
 	if err := a.server.Shutdown(shutdownCtx); err != nil {
 		a.zapLogger.Errorf("shutdown: %v", err)
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		a.zapLogger.Errorf("closing tracer: %v", err)
+	}
 
 	longShutdown := make(chan struct{}, 1)
 
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"fmt"
+	"kod/internal/models"
+	"kod/internal/util"
+	"net/http"
+	"strconv"
+)
+
+// HandleChangePassword revokes other sessions and renews the caller's cookie
+func (c *Handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	var req models.ChangePasswordRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	session, err := c.userService.ChangePassword(r.Context(), &req)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error ChangePassword: %w", err))
+		return
+	}
+
+	writeSession(w, session, http.StatusNoContent)
+}
+
+// HandleDeleteAccount deletes the user and their notes.
+// With ?export=true the response carries the deleted data, otherwise it is empty.
+func (c *Handler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	var req models.DeleteAccountRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	export, _ := strconv.ParseBool(r.URL.Query().Get("export"))
+	data, err := c.userService.DeleteAccount(r.Context(), &req, export)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error DeleteAccount: %w", err))
+		return
+	}
+
+	session, err := c.userService.LogOut()
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error DeleteAccount: %w", err))
+		return
+	}
+	setSessionCookies(w, session)
+
+	if data == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	util.WriteJSON(w, data)
+}
+
+func (c *Handler) HandleGetAccount(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	user, err := c.profileService.GetProfile(r.Context())
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error GetAccount: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, models.NewUserResponse(user))
+}
+
+func (c *Handler) HandleUpdateAccount(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	var req models.UpdateProfileRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	user, err := c.profileService.UpdateProfile(r.Context(), &req)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error UpdateAccount: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, models.NewUserResponse(user))
+}
+
+func (c *Handler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	if err := c.profileService.ResendVerification(r.Context()); err != nil {
+		c.fail(w, r, fmt.Errorf("Error ResendVerification: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleVerifyEmail is opened from the mailed link, the signed token is the only credential
+func (c *Handler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if err := c.profileService.VerifyEmail(r.Context(), r.URL.Query().Get("token")); err != nil {
+		c.fail(w, r, fmt.Errorf("Error VerifyEmail: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
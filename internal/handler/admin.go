@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"kod/internal/models"
+	"kod/internal/service"
+	"kod/internal/util"
+	"net/http"
+	"strconv"
+)
+
+// HandleListUsers searches users by ?q= in username or email, ?p= is the page
+func (c *Handler) HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := c.adminService.ListUsers(r)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error ListUsers: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, users)
+}
+
+func (c *Handler) HandleGetUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := pathId(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	user, err := c.adminService.GetUser(r.Context(), userId)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error GetUser: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, user)
+}
+
+func (c *Handler) HandleDisableUser(w http.ResponseWriter, r *http.Request) {
+	c.setDisabled(w, r, true)
+}
+
+func (c *Handler) HandleEnableUser(w http.ResponseWriter, r *http.Request) {
+	c.setDisabled(w, r, false)
+}
+
+func (c *Handler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	userId, err := pathId(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.adminService.SetDisabled(r.Context(), userId, disabled); err != nil {
+		c.fail(w, r, fmt.Errorf("Error SetDisabled: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Handler) HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	userId, err := pathId(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	var req models.SetRoleRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.adminService.SetRole(r.Context(), userId, &req); err != nil {
+		c.fail(w, r, fmt.Errorf("Error SetRole: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Handler) HandleForceLogOut(w http.ResponseWriter, r *http.Request) {
+	userId, err := pathId(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.adminService.ForceLogOut(r.Context(), userId); err != nil {
+		c.fail(w, r, fmt.Errorf("Error ForceLogOut: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathId parses the {id} route variable
+func pathId(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		return 0, service.NotFound("invalid_id", "id must be a positive integer")
+	}
+	return id, nil
+}
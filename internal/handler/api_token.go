@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fmt"
+	"kod/internal/models"
+	"kod/internal/util"
+	"net/http"
+)
+
+func (c *Handler) HandleListApiTokens(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	tokens, err := c.apiTokenService.List(r.Context())
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error ListApiTokens: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, tokens)
+}
+
+// HandleCreateApiToken responds 201 with the token secret, it can't be retrieved later
+func (c *Handler) HandleCreateApiToken(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	var req models.CreateApiTokenRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	token, err := c.apiTokenService.Create(r.Context(), &req)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error CreateApiToken: %w", err))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	util.WriteJSONStatus(w, http.StatusCreated, token)
+}
+
+func (c *Handler) HandleDeleteApiToken(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	tokenId, err := pathId(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.apiTokenService.Delete(r.Context(), tokenId); err != nil {
+		c.fail(w, r, fmt.Errorf("Error DeleteApiToken: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
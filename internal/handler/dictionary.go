@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"fmt"
+	"kod/internal/models"
+	"kod/internal/util"
+	"net/http"
+)
+
+func (c *Handler) HandleListDictionary(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	words, err := c.dictionaryService.List(r.Context())
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error ListDictionary: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, words)
+}
+
+func (c *Handler) HandleAddDictionaryWord(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	var req models.AddDictionaryWordRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	word, err := c.dictionaryService.Add(r.Context(), &req)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error AddDictionaryWord: %w", err))
+		return
+	}
+
+	util.WriteJSONStatus(w, http.StatusCreated, word)
+}
+
+func (c *Handler) HandleDeleteDictionaryWord(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	wordId, err := pathId(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.dictionaryService.Delete(r.Context(), wordId); err != nil {
+		c.fail(w, r, fmt.Errorf("Error DeleteDictionaryWord: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Handler) HandleListOrgDictionary(w http.ResponseWriter, r *http.Request) {
+	words, err := c.dictionaryService.ListOrg(r.Context())
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error ListOrgDictionary: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, words)
+}
+
+func (c *Handler) HandleAddOrgDictionaryWord(w http.ResponseWriter, r *http.Request) {
+	var req models.AddDictionaryWordRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	word, err := c.dictionaryService.AddOrg(r.Context(), &req)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error AddOrgDictionaryWord: %w", err))
+		return
+	}
+
+	util.WriteJSONStatus(w, http.StatusCreated, word)
+}
+
+func (c *Handler) HandleDeleteOrgDictionaryWord(w http.ResponseWriter, r *http.Request) {
+	wordId, err := pathId(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.dictionaryService.DeleteOrg(r.Context(), wordId); err != nil {
+		c.fail(w, r, fmt.Errorf("Error DeleteOrgDictionaryWord: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
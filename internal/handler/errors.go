@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"kod/internal/httperr"
+	"kod/internal/service"
+	"net/http"
+)
+
+func (c *Handler) HandleNotFound(w http.ResponseWriter, r *http.Request) {
+	httperr.WriteError(w, r, service.NotFound("route_not_found", "no route for this path"))
+}
+
+func (c *Handler) HandleMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	httperr.WriteError(w, r, &service.Error{Kind: httperr.ErrMethodNotAllowed, Code: "method_not_allowed", Message: "method is not allowed for this path"})
+}
@@ -1,47 +1,72 @@
 package handler
 
 import (
-	"context"
-	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"kod/internal/httperr"
 	"kod/internal/models"
 	"kod/internal/service"
 	"kod/internal/util"
 	"net/http"
 )
 
+// accountPath is the resource of the authenticated user
+const accountPath = "/account"
+
 type Handler struct {
-	noteService *service.NoteService
-	userService *service.UserService
-	zapLogger   *zap.SugaredLogger
+	noteService       *service.NoteService
+	userService       *service.UserService
+	passwordService   *service.PasswordService
+	profileService    *service.ProfileService
+	mfaService        *service.MfaService
+	adminService      *service.AdminService
+	apiTokenService   *service.ApiTokenService
+	oidcService       *service.OidcService
+	dictionaryService *service.DictionaryService
+	zapLogger         *zap.SugaredLogger
 }
 
-func NewHandler(ns *service.NoteService, us *service.UserService, l *zap.SugaredLogger) *Handler {
+func NewHandler(ns *service.NoteService, us *service.UserService, ps *service.PasswordService, prs *service.ProfileService, ms *service.MfaService, as *service.AdminService, ts *service.ApiTokenService, ois *service.OidcService, ds *service.DictionaryService, l *zap.SugaredLogger) *Handler {
 	return &Handler{
-		noteService: ns,
-		userService: us,
-		zapLogger:   l,
+		noteService:       ns,
+		userService:       us,
+		passwordService:   ps,
+		profileService:    prs,
+		mfaService:        ms,
+		adminService:      as,
+		apiTokenService:   ts,
+		oidcService:       ois,
+		dictionaryService: ds,
+		zapLogger:         l,
 	}
 }
 
+// fail records err on the request span, logs it with the request-scoped logger
+// and writes it as a problem response
+func (c *Handler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	trace.SpanFromContext(r.Context()).RecordError(err)
+	problem := httperr.NewProblem(r, err)
+	logger := util.LoggerFromContext(r.Context(), c.zapLogger)
+	if problem.Status >= http.StatusInternalServerError {
+		logger.Error(err)
+	} else {
+		logger.Info(err)
+	}
+	httperr.WriteProblem(w, problem)
+}
+
 func (c *Handler) HandleAddNote(w http.ResponseWriter, r *http.Request) {
 	//Middleware already verified a token
 	var note models.Note
 	if err := util.DecodeJSONBody(r, &note); err != nil {
-		c.zapLogger.Error(err)
-		var mr *util.MalformedRequest
-		if errors.As(err, &mr) {
-			http.Error(w, mr.Msg, mr.Status)
-		} else {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
+		c.fail(w, r, err)
 		return
 	}
 
 	newNote, err := c.noteService.AddNote(r, &note)
 	if err != nil {
-		c.zapLogger.Error(err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		c.fail(w, r, fmt.Errorf("Error AddNote: %w", err))
 		return
 	}
 
@@ -52,68 +77,111 @@ func (c *Handler) HandleGetNotes(w http.ResponseWriter, r *http.Request) {
 	//Middleware already verified a token
 	notes, err := c.noteService.GetNotes(r)
 	if err != nil {
-		c.zapLogger.Errorf("Error getting notes: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		c.fail(w, r, fmt.Errorf("Error getting notes: %w", err))
 		return
 	}
 
 	util.WriteJSON(w, notes)
 }
 
+// HandleSignUp responds 201 with the created user, and logs them in when asked to
 func (c *Handler) HandleSignUp(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	if err := util.DecodeJSONBody(r, &user); err != nil {
-		c.zapLogger.Error(err)
-		var mr *util.MalformedRequest
-		if errors.As(err, &mr) {
-			http.Error(w, mr.Msg, mr.Status)
-			return
-		}
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	var req models.SignUpRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
 		return
 	}
 
-	newUser, err := c.userService.SignUp(r.Context(), &user)
+	newUser, err := c.userService.SignUp(r.Context(), &req)
 	if err != nil {
-		c.zapLogger.Errorf("Error SingUp: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		c.fail(w, r, fmt.Errorf("Error SingUp: %w", err))
 		return
 	}
 
-	util.WriteJSON(w, newUser)
+	if newUser.Email != nil {
+		if err := c.profileService.SendVerification(r.Context(), newUser); err != nil {
+			util.LoggerFromContext(r.Context(), c.zapLogger).Errorf("sending verification: %v", err)
+		}
+	}
+
+	if req.Login {
+		session, err := c.userService.NewSession(newUser, service.TransportCookie)
+		if err != nil {
+			c.fail(w, r, fmt.Errorf("Error SingUp: %w", err))
+			return
+		}
+		setSessionCookies(w, session)
+	}
+
+	w.Header().Set("Location", accountPath)
+	util.WriteJSONStatus(w, http.StatusCreated, models.NewUserResponse(newUser))
 }
 
 func (c *Handler) HandleLogIn(w http.ResponseWriter, r *http.Request) {
-	var user models.User
+	var user models.LogInRequest
 	if err := util.DecodeJSONBody(r, &user); err != nil {
-		c.zapLogger.Error(err)
-		var mr *util.MalformedRequest
-		if errors.As(err, &mr) {
-			http.Error(w, mr.Msg, mr.Status)
-			return
-		}
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		c.fail(w, r, err)
+		return
+	}
+
+	session, challenge, err := c.userService.LogIn(r, &user)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error LogIn: %w", err))
+		return
+	}
+	if challenge != nil {
+		util.WriteJSON(w, challenge)
+		return
+	}
+
+	writeSession(w, session, http.StatusOK)
+}
+
+// HandleLogInMfa is the second login step for users with two-factor authentication
+func (c *Handler) HandleLogInMfa(w http.ResponseWriter, r *http.Request) {
+	var req models.MfaLogInRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
 		return
 	}
 
-	cookie, err := c.userService.LogIn(r, &user)
+	session, err := c.userService.LogInMfa(r.Context(), &req)
 	if err != nil {
-		c.zapLogger.Errorf("Error LogIn: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		c.fail(w, r, fmt.Errorf("Error LogInMfa: %w", err))
 		return
 	}
 
-	http.SetCookie(w, cookie)
+	writeSession(w, session, http.StatusOK)
+}
+
+// writeSession sets the session cookie and responds with status, or returns the bearer token in the body
+func writeSession(w http.ResponseWriter, session *service.Session, status int) {
+	if session.Token != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		util.WriteJSON(w, session.Token)
+		return
+	}
+
+	setSessionCookies(w, session)
+	w.WriteHeader(status)
+}
+
+func setSessionCookies(w http.ResponseWriter, session *service.Session) {
+	http.SetCookie(w, session.Cookie)
+	if session.CsrfCookie != nil {
+		http.SetCookie(w, session.CsrfCookie)
+		if session.CsrfCookie.Value != "" {
+			w.Header().Set(service.CsrfHeader, session.CsrfCookie.Value)
+		}
+	}
 }
 
 func (c *Handler) HandleLogOut(w http.ResponseWriter, r *http.Request) {
-	emptyCookie, err := c.userService.LogOut()
+	session, err := c.userService.LogOut()
 	if err != nil {
-		c.zapLogger.Errorf("Error LogOut: %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		c.fail(w, r, fmt.Errorf("Error LogOut: %w", err))
 		return
 	}
-	r = r.WithContext(context.Background())
 
-	http.SetCookie(w, emptyCookie)
-}
\ No newline at end of file
+	writeSession(w, session, http.StatusNoContent)
+}
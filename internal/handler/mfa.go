@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fmt"
+	"kod/internal/models"
+	"kod/internal/util"
+	"net/http"
+)
+
+// HandleEnrollTotp returns the secret and otpauth URI to add to an authenticator app
+func (c *Handler) HandleEnrollTotp(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	enrollment, err := c.mfaService.EnrollTotp(r.Context())
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error EnrollTotp: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, enrollment)
+}
+
+// HandleConfirmTotp enables TOTP and returns recovery codes, which are never shown again
+func (c *Handler) HandleConfirmTotp(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	var req models.TotpCodeRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	codes, err := c.mfaService.ConfirmTotp(r.Context(), &req)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error ConfirmTotp: %w", err))
+		return
+	}
+
+	util.WriteJSON(w, codes)
+}
+
+func (c *Handler) HandleDisableTotp(w http.ResponseWriter, r *http.Request) {
+	//Middleware already verified a token
+	var req models.DisableTotpRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.mfaService.DisableTotp(r.Context(), &req); err != nil {
+		c.fail(w, r, fmt.Errorf("Error DisableTotp: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"kod/internal/service"
+	"net/http"
+)
+
+// HandleOidcLogin redirects the browser to the identity provider
+func (c *Handler) HandleOidcLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, stateCookie, err := c.oidcService.Begin(r.Context(), mux.Vars(r)["provider"])
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error OidcLogin: %w", err))
+		return
+	}
+
+	http.SetCookie(w, stateCookie)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleOidcCallback completes the login and redirects to the app,
+// users with two-factor authentication are sent to the app's page for POST /login/mfa instead
+func (c *Handler) HandleOidcCallback(w http.ResponseWriter, r *http.Request) {
+	var stateToken string
+	if cookie, err := r.Cookie(service.OidcStateCookie); err == nil {
+		stateToken = cookie.Value
+	}
+	// The state is single use whatever the outcome
+	http.SetCookie(w, &http.Cookie{Name: service.OidcStateCookie, Path: "/auth/oidc/", MaxAge: -1, HttpOnly: true, Secure: true})
+
+	session, challenge, err := c.oidcService.Complete(r.Context(), mux.Vars(r)["provider"], r.URL.Query(), stateToken)
+	if err != nil {
+		c.fail(w, r, fmt.Errorf("Error OidcCallback: %w", err))
+		return
+	}
+	if challenge != nil {
+		http.Redirect(w, r, c.oidcService.MfaURL(challenge), http.StatusSeeOther)
+		return
+	}
+
+	setSessionCookies(w, session)
+	http.Redirect(w, r, c.oidcService.PostLoginURL(), http.StatusSeeOther)
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"fmt"
+	"kod/internal/models"
+	"kod/internal/util"
+	"net/http"
+)
+
+// HandleForgotPassword always answers 202, whether or not the email is registered
+func (c *Handler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.passwordService.Forgot(r.Context(), &req); err != nil {
+		c.fail(w, r, fmt.Errorf("Error ForgotPassword: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (c *Handler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := util.DecodeJSONBody(r, &req); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.passwordService.Reset(r.Context(), &req); err != nil {
+		c.fail(w, r, fmt.Errorf("Error ResetPassword: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
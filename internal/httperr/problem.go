@@ -0,0 +1,98 @@
+// Package httperr renders errors as RFC 7807 problem details.
+// It is shared by handlers and middleware.
+package httperr
+
+import (
+	"encoding/json"
+	"errors"
+	"kod/internal/service"
+	"kod/internal/util"
+	"net/http"
+)
+
+const problemContentType = "application/problem+json"
+
+// ErrMethodNotAllowed is a transport-level kind, the service layer never returns it
+var ErrMethodNotAllowed = errors.New("method not allowed")
+
+// Problem is an RFC 7807 problem details body extended with a stable error code
+type Problem struct {
+	Type      string               `json:"type"`
+	Title     string               `json:"title"`
+	Status    int                  `json:"status"`
+	Detail    string               `json:"detail,omitempty"`
+	Instance  string               `json:"instance,omitempty"`
+	Code      string               `json:"code"`
+	RequestId string               `json:"request_id,omitempty"`
+	Errors    []service.FieldError `json:"errors,omitempty"`
+}
+
+// statusOf is the single mapping from service error kinds to HTTP statuses
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, service.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrUpstream):
+		return http.StatusBadGateway
+	case errors.Is(err, ErrMethodNotAllowed):
+		return http.StatusMethodNotAllowed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// NewProblem converts err to problem details.
+// Errors that are not domain errors are reported as internal without details.
+func NewProblem(r *http.Request, err error) Problem {
+	problem := Problem{
+		Type:      "about:blank",
+		Instance:  r.URL.Path,
+		RequestId: util.RequestIdFromContext(r.Context()),
+	}
+
+	var mr *util.MalformedRequest
+	var de *service.Error
+	switch {
+	case errors.As(err, &mr):
+		problem.Status = mr.Status
+		problem.Code = "malformed_request"
+		problem.Detail = mr.Msg
+	case errors.As(err, &de):
+		problem.Status = statusOf(de)
+		problem.Code = de.Code
+		problem.Detail = de.Message
+		problem.Errors = de.Fields
+	default:
+		problem.Status = http.StatusInternalServerError
+		problem.Code = "internal"
+	}
+	problem.Title = http.StatusText(problem.Status)
+
+	return problem
+}
+
+// WriteError writes err as application/problem+json
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	WriteProblem(w, NewProblem(r, err))
+}
+
+// WriteProblem writes problem as application/problem+json
+func WriteProblem(w http.ResponseWriter, problem Problem) {
+	if problem.Status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
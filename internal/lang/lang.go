@@ -0,0 +1,116 @@
+// Package lang detects the language of note texts
+package lang
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Supported languages
+const (
+	Russian   = "ru"
+	English   = "en"
+	Ukrainian = "uk"
+)
+
+// IsSupported reports whether l is a supported language code
+func IsSupported(l string) bool {
+	return l == Russian || l == English || l == Ukrainian
+}
+
+// Detect guesses the language of text from its letters: Latin script means English,
+// Cyrillic is Ukrainian when letters found only in Ukrainian outnumber those found only in Russian.
+// It returns "" for text without letters.
+func Detect(text string) string {
+	var latin, cyrillic, ukrainian, russian int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			switch unicode.ToLower(r) {
+			case 'і', 'ї', 'є', 'ґ':
+				ukrainian++
+			case 'ы', 'э', 'ъ', 'ё':
+				russian++
+			}
+		}
+	}
+
+	switch {
+	case latin == 0 && cyrillic == 0:
+		return ""
+	case latin > cyrillic:
+		return English
+	case ukrainian > russian:
+		return Ukrainian
+	default:
+		return Russian
+	}
+}
+
+// ForeignLetters returns the letters that don't occur in language l, nil for English
+func ForeignLetters(l string) []rune {
+	switch l {
+	case Russian:
+		return []rune{'і', 'ї', 'є', 'ґ'}
+	case Ukrainian:
+		return []rune{'ы', 'э', 'ъ', 'ё'}
+	default:
+		return nil
+	}
+}
+
+// Word is a word of a text positioned in runes: Pos counts from the start of the text,
+// Row and Col are the line and the rune in it
+type Word struct {
+	Text string
+	Pos  int
+	Row  int
+	Col  int
+	Len  int
+}
+
+// Words splits text into words of letters, apostrophes inside a word belong to it
+func Words(text string) []Word {
+	var result []Word
+	var word []rune
+	var start Word
+	flush := func() {
+		trimmed := strings.TrimLeft(string(word), "'’")
+		skipped := len(word) - len([]rune(trimmed))
+		if w := strings.TrimRight(trimmed, "'’"); w != "" {
+			result = append(result, Word{
+				Text: w,
+				Pos:  start.Pos + skipped,
+				Row:  start.Row,
+				Col:  start.Col + skipped,
+				Len:  len([]rune(w)),
+			})
+		}
+		word = word[:0]
+	}
+
+	var pos, row, col int
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsMark(r) || r == '\'' || r == '’' {
+			if len(word) == 0 {
+				start = Word{Pos: pos, Row: row, Col: col}
+			}
+			word = append(word, r)
+		} else {
+			flush()
+		}
+
+		pos++
+		col++
+		if r == '\n' {
+			row++
+			col = 0
+		}
+	}
+	flush()
+
+	return result
+}
@@ -0,0 +1,46 @@
+package lang
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"russian", "Привет, как дела?", Russian},
+		{"russian letters only russian has", "Съешь ещё этих булок", Russian},
+		{"ukrainian", "Привіт, як справи? Їжак і ґанок", Ukrainian},
+		{"english", "Hello, how are you?", English},
+		{"mostly cyrillic", "Заметка про Go и мир", Russian},
+		{"mostly latin", "Meeting notes: обед", English},
+		{"even mix", "abc где", Russian},
+		{"empty", "", ""},
+		{"no letters", "123 + 456 = 579!", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.text); got != tt.want {
+				t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	words := Words("Don't stop,\n'мама' мыла")
+	want := []Word{
+		{Text: "Don't", Pos: 0, Row: 0, Col: 0, Len: 5},
+		{Text: "stop", Pos: 6, Row: 0, Col: 6, Len: 4},
+		{Text: "мама", Pos: 13, Row: 1, Col: 1, Len: 4},
+		{Text: "мыла", Pos: 19, Row: 1, Col: 7, Len: 4},
+	}
+	if len(words) != len(want) {
+		t.Fatalf("got %+v, want %+v", words, want)
+	}
+	for i := range want {
+		if words[i] != want[i] {
+			t.Errorf("word %d = %+v, want %+v", i, words[i], want[i])
+		}
+	}
+}
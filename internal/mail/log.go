@@ -0,0 +1,20 @@
+package mail
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+// LogMailer only logs messages, for development
+type LogMailer struct {
+	zapLogger *zap.SugaredLogger
+}
+
+func NewLogMailer(l *zap.SugaredLogger) *LogMailer {
+	return &LogMailer{zapLogger: l}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.zapLogger.Infow("mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,31 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"kod/internal/models/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain text messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailer returns the mailer selected by cfg.Driver
+func NewMailer(cfg *config.MailConfig, l *zap.SugaredLogger) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "log", "":
+		return NewLogMailer(l), nil
+	default:
+		return nil, fmt.Errorf("mail.NewMailer: unknown driver %q", cfg.Driver)
+	}
+}
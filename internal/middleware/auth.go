@@ -2,54 +2,172 @@ package middleware
 
 import (
 	"errors"
-	"github.com/opentracing/opentracing-go"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
+	"kod/internal/httperr"
 	"kod/internal/models"
 	"kod/internal/service"
+	"kod/internal/util"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type Middleware struct {
-	sessionService *service.SessionService
-	zapLogger      *zap.SugaredLogger
+	sessionService  *service.SessionService
+	userService     *service.UserService
+	apiTokenService *service.ApiTokenService
+	zapLogger       *zap.SugaredLogger
 }
 
-func NewMiddleware(ss *service.SessionService, l *zap.SugaredLogger) *Middleware {
-	return &Middleware{sessionService: ss, zapLogger: l}
+func NewMiddleware(ss *service.SessionService, us *service.UserService, ts *service.ApiTokenService, l *zap.SugaredLogger) *Middleware {
+	return &Middleware{sessionService: ss, userService: us, apiTokenService: ts, zapLogger: l}
 }
 
-// AuthMiddleware extracts user from cookie, validates and pass it to context
+// AuthMiddleware authenticates the request by a session jwt in the Authorization header,
+// or else by the session cookie, and passes the user to context. Personal API tokens are rejected.
 func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
+	return m.authenticate(next, false)
+}
+
+// ApiAuthMiddleware is AuthMiddleware that also accepts personal API tokens.
+// It guards only the routes API tokens are meant for, so a leaked token can't reach the account or admin API.
+func (m *Middleware) ApiAuthMiddleware(next http.Handler) http.Handler {
+	return m.authenticate(next, true)
+}
+
+func (m *Middleware) authenticate(next http.Handler, allowApiTokens bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		span, _ := opentracing.StartSpanFromContext(r.Context(), "middleware.Auth")
-		defer span.Finish()
+		serverSpan := trace.SpanFromContext(r.Context())
+		ctx, span := tracer.Start(r.Context(), "middleware.Auth")
+		defer span.End()
+		r = r.WithContext(ctx)
 
-		tokenString, err := m.sessionService.GetCookieValue(r)
-		if err != nil {
-			m.zapLogger.Errorf("unauthorized: %v", err)
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
+		var user *models.User
+		var method string
+		var err error
+		token, bearer := bearerToken(r)
+		switch {
+		case bearer && strings.HasPrefix(token, service.ApiTokenPrefix):
+			method = service.AuthApiToken
+			if !allowApiTokens {
+				err = service.Forbidden("session_required", "API tokens can't be used on this route")
+				break
+			}
+			user, err = m.apiTokenService.Authenticate(ctx, token, r.Method)
+		case bearer:
+			method = service.AuthBearer
+			user, err = m.bearerUser(r, token)
+		default:
+			method = service.AuthSession
+			user, err = m.sessionUser(r)
 		}
-
-		claims, err := m.sessionService.ValidateToken(tokenString)
 		if err != nil {
-			m.zapLogger.Error(err)
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			m.reject(w, r, span, err)
 			return
 		}
 
+		serverSpan.SetAttributes(semconv.EnduserID(strconv.Itoa(user.Id)))
+		span.SetAttributes(attribute.String("auth.method", method))
+		util.AddLogFields(ctx, "user_id", user.Id, "auth_method", method)
+
 		userCtx := &models.User{
-			Id:       claims.UserId,
-			Username: claims.UserName,
+			Id:       user.Id,
+			Username: user.Username,
+			Role:     user.Role,
+			Language: user.Language,
 		}
 
 		r = service.SetUserContext(r, userCtx)
+		r = service.SetAuthMethodContext(r, method)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// sessionUser authenticates the session cookie
+func (m *Middleware) sessionUser(r *http.Request) (*models.User, error) {
+	if !m.sessionService.AllowsTransport(service.TransportCookie) {
+		return nil, service.Unauthorized("session_missing", "cookie sessions are disabled, use a bearer token")
+	}
+
+	tokenString, err := m.sessionService.GetCookieValue(r)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := m.sessionService.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.userService.Authenticate(r.Context(), claims)
+}
+
+// bearerUser authenticates a session jwt sent in the Authorization header
+func (m *Middleware) bearerUser(r *http.Request, tokenString string) (*models.User, error) {
+	if !m.sessionService.AllowsTransport(service.TransportBearer) {
+		return nil, service.Unauthorized("token_invalid", "bearer sessions are disabled")
+	}
+
+	claims, err := m.sessionService.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.userService.Authenticate(r.Context(), claims)
+}
+
+// bearerToken returns the credentials of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RequireRole lets through only users with role, it must run after AuthMiddleware
+func (m *Middleware) RequireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := service.GetUserFromContext(r.Context())
+			if err != nil {
+				m.reject(w, r, trace.SpanFromContext(r.Context()), err)
+				return
+			}
+			if user.Role != role {
+				err := service.Forbidden("forbidden", fmt.Sprintf("%s role required", role))
+				util.LoggerFromContext(r.Context(), m.zapLogger).Infof("forbidden: %v", err)
+				httperr.WriteError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// reject records a failed authentication on span and writes the error
+func (m *Middleware) reject(w http.ResponseWriter, r *http.Request, span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "unauthorized")
+	logger := util.LoggerFromContext(r.Context(), m.zapLogger)
+	if errors.Is(err, service.ErrUnauthorized) || errors.Is(err, service.ErrForbidden) {
+		logger.Infof("unauthorized: %v", err)
+	} else {
+		logger.Error(err)
+	}
+	httperr.WriteError(w, r, err)
+}
+
 // RateLimit allows 2 requests per second and 4 requests in a single ‘burst’
 func (m *Middleware) RateLimit(next http.Handler) http.Handler {
 
@@ -57,9 +175,10 @@ func (m *Middleware) RateLimit(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !limiter.Allow() {
-			err := errors.New("rate limit exceeded")
-			m.zapLogger.Error(err)
-			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			err := service.RateLimited("rate_limited", "rate limit exceeded")
+			trace.SpanFromContext(r.Context()).RecordError(err)
+			util.LoggerFromContext(r.Context(), m.zapLogger).Warn(err)
+			httperr.WriteError(w, r, err)
 			return
 		}
 
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/service"
+	"kod/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// userStorage serves a single user, the rest of storage.Storage is never called by AuthMiddleware
+type userStorage struct {
+	storage.Storage
+	user models.User
+}
+
+func (s *userStorage) GetUserById(ctx context.Context, userId int) (models.User, error) {
+	return s.user, nil
+}
+
+// TestAuthRejectsForeignTokens checks that only a session jwt opens a session.
+// The other tokens are signed with the same secret and carry the same user_id,
+// the user's session version is 0 so that only the token's purpose can tell them apart.
+func TestAuthRejectsForeignTokens(t *testing.T) {
+	cfg := &config.SessionConfig{
+		CookieTTL:      time.Minute,
+		CookieName:     "jwt",
+		JwtTTL:         time.Minute,
+		JwtSecret:      "secret",
+		MfaTokenTTL:    time.Minute,
+		AuthTransports: []string{service.TransportCookie, service.TransportBearer},
+	}
+	user := models.User{Id: 1, Username: "alice", Role: models.RoleUser}
+	ss := service.NewSessionService(cfg)
+	us := service.NewUserService(&userStorage{user: user}, ss, nil)
+	m := NewMiddleware(ss, us, nil, zap.NewNop().Sugar())
+
+	session, err := ss.CreateToken(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa, err := ss.CreateMfaToken(&user, "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, err := ss.CreateEmailToken(user.Id, "alice@example.com", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := ss.CreateOidcStateToken("mock", "state", "nonce", "verifier", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, models.Claims{
+		UserId:   user.Id,
+		UserName: user.Username,
+		Role:     user.Role,
+		Purpose:  "session",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}).SignedString([]byte(cfg.JwtSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := m.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"session", session, http.StatusNoContent},
+		{"mfa challenge", mfa, http.StatusUnauthorized},
+		{"email verification", email, http.StatusUnauthorized},
+		{"oidc state", state, http.StatusUnauthorized},
+		{"other signing method", hs256, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/bearer", func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/notes", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+		t.Run(tt.name+"/cookie", func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/notes", nil)
+			r.AddCookie(&http.Cookie{Name: cfg.CookieName, Value: base64.URLEncoding.EncodeToString([]byte(tt.token))})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// TestAuthRejectsApiTokens checks that API tokens are turned away before lookup on session-only routes
+func TestAuthRejectsApiTokens(t *testing.T) {
+	cfg := &config.SessionConfig{JwtSecret: "secret", AuthTransports: []string{service.TransportCookie, service.TransportBearer}}
+	ss := service.NewSessionService(cfg)
+	m := NewMiddleware(ss, service.NewUserService(&userStorage{}, ss, nil), nil, zap.NewNop().Sugar())
+
+	handler := m.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/account", nil)
+	r.Header.Set("Authorization", "Bearer "+service.ApiTokenPrefix+"secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
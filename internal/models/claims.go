@@ -6,8 +6,39 @@ import (
 )
 
 type Claims struct {
-	UserId    int       `json:"user_id"`
-	UserName  string    `json:"username"`
-	ExpiresAt time.Time `json:"expires_at"`
+	UserId   int    `json:"user_id"`
+	UserName string `json:"username"`
+	Role     string `json:"role"`
+	// SessionVersion must match the user's current version
+	SessionVersion int       `json:"sv"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	// Purpose tells a session apart from the other tokens signed with the same secret
+	Purpose string `json:"purpose"`
 	jwt.RegisteredClaims
-}
\ No newline at end of file
+}
+
+// EmailClaims sign an email verification link
+type EmailClaims struct {
+	UserId  int    `json:"user_id"`
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// MfaClaims sign the challenge between the password and the second factor step of a login
+type MfaClaims struct {
+	UserId         int    `json:"user_id"`
+	SessionVersion int    `json:"sv"`
+	Purpose        string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// OidcStateClaims sign the state of an OpenID Connect login kept in a cookie until the callback
+type OidcStateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Purpose  string `json:"purpose"`
+	jwt.RegisteredClaims
+}
@@ -0,0 +1,11 @@
+package config
+
+import "time"
+
+type AccountConfig struct {
+	// BaseURL is used to build links sent to users
+	BaseURL        string        `env:"APP_BASE_URL"`
+	ResetTokenTTL  time.Duration `env:"RESET_TOKEN_TTL" envDefault:"30m"`
+	VerifyEmailTTL time.Duration `env:"VERIFY_EMAIL_TTL" envDefault:"24h"`
+	TotpIssuer     string        `env:"TOTP_ISSUER" envDefault:"kod"`
+}
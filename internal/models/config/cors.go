@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+type CorsConfig struct {
+	// AllowedOrigins are exact origins like https://app.example.com, "*" allows any origin without credentials
+	AllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `env:"CORS_ALLOWED_METHODS" envDefault:"GET,POST,PUT,PATCH,DELETE"`
+	AllowedHeaders   []string      `env:"CORS_ALLOWED_HEADERS" envDefault:"Content-Type,Authorization,X-CSRF-Token,X-Request-ID"`
+	ExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS" envDefault:"Location,Retry-After,X-Request-ID,X-Trace-Id,X-CSRF-Token"`
+	AllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" envDefault:"true"`
+	MaxAge           time.Duration `env:"CORS_MAX_AGE" envDefault:"10m"`
+}
@@ -0,0 +1,6 @@
+package config
+
+type DictionaryConfig struct {
+	// File lists organization-wide words one per line, lines starting with # are comments
+	File string `env:"DICTIONARY_FILE"`
+}
@@ -0,0 +1,6 @@
+package config
+
+type LogConfig struct {
+	Level  string `env:"LOG_LEVEL" envDefault:"info"`
+	Format string `env:"LOG_FORMAT" envDefault:"console"`
+}
@@ -0,0 +1,12 @@
+package config
+
+type MailConfig struct {
+	// Driver is "smtp" or "log"
+	Driver   string `env:"MAIL_DRIVER" envDefault:"log"`
+	Host     string `env:"SMTP_HOST"`
+	Port     string `env:"SMTP_PORT"`
+	Username string `env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD"`
+	StartTLS bool   `env:"SMTP_STARTTLS"`
+	From     string `env:"MAIL_FROM"`
+}
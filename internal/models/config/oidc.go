@@ -0,0 +1,28 @@
+package config
+
+import "time"
+
+// OidcConfig lists the OpenID Connect providers from OIDC_PROVIDERS,
+// each configured by OIDC_<NAME>_* variables
+type OidcConfig struct {
+	Providers []OidcProvider
+	StateTTL  time.Duration `env:"OIDC_STATE_TTL" envDefault:"10m"`
+	// PostLoginURL is where the browser is sent after a successful login
+	PostLoginURL string `env:"OIDC_POST_LOGIN_URL"`
+	// MfaURL is the front-end page asking for the second factor, it gets the mfa_token in the fragment
+	MfaURL string `env:"OIDC_MFA_URL"`
+}
+
+type OidcProvider struct {
+	Name         string
+	Issuer       string   `env:"OIDC_<NAME>_ISSUER"`
+	ClientId     string   `env:"OIDC_<NAME>_CLIENT_ID"`
+	ClientSecret string   `env:"OIDC_<NAME>_CLIENT_SECRET"`
+	Scopes       []string `env:"OIDC_<NAME>_SCOPES" envDefault:"openid,email,profile"`
+	RedirectURL  string   `env:"OIDC_<NAME>_REDIRECT_URL"`
+	// AutoProvision creates a user on the first login of an unknown identity
+	AutoProvision bool `env:"OIDC_<NAME>_AUTO_PROVISION" envDefault:"true"`
+	// LinkByEmail links an unknown identity to the user who verified the same email.
+	// Only providers trusted to verify emails should have it.
+	LinkByEmail bool `env:"OIDC_<NAME>_LINK_BY_EMAIL" envDefault:"false"`
+}
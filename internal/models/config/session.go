@@ -7,4 +7,10 @@ type SessionConfig struct {
 	CookieName string        `env:"COOKIE_NAME" envDefault:"jwt"`
 	JwtTTL     time.Duration `env:"JWT_TTL" envDefault:"5m"`
 	JwtSecret  string        `env:"JWT_SECRET"`
+	// MfaTokenTTL bounds the time between the password and the second factor of a login
+	MfaTokenTTL time.Duration `env:"MFA_TOKEN_TTL" envDefault:"5m"`
+	// AuthTransports lists how a session jwt may travel: "cookie", "bearer" or both
+	AuthTransports []string `env:"AUTH_TRANSPORTS" envDefault:"cookie"`
+	// TrustedOrigins may send cookie authenticated state-changing requests, APP_BASE_URL by default
+	TrustedOrigins []string `env:"CSRF_TRUSTED_ORIGINS"`
 }
\ No newline at end of file
@@ -0,0 +1,54 @@
+package config
+
+import "time"
+
+// When notes are checked
+const (
+	// CheckSync checks a note before saving it
+	CheckSync = "sync"
+	// CheckAsync saves a note right away and checks it in a background worker
+	CheckAsync = "async"
+)
+
+// Speller failure policies
+const (
+	// FailClosed rejects the note when the speller can't be reached
+	FailClosed = "closed"
+	// FailOpen saves the note marked unchecked
+	FailOpen = "open"
+)
+
+type SpellerConfig struct {
+	URL            string        `env:"SPELLER_URL" envDefault:"https://speller.yandex.net/services/spellservice.json"`
+	ConnectTimeout time.Duration `env:"SPELLER_CONNECT_TIMEOUT" envDefault:"1s"`
+	// Timeout bounds a whole check including retries, a shorter request deadline wins
+	Timeout      time.Duration `env:"SPELLER_TIMEOUT" envDefault:"5s"`
+	MaxRetries   int           `env:"SPELLER_MAX_RETRIES" envDefault:"2"`
+	RetryBackoff time.Duration `env:"SPELLER_RETRY_BACKOFF" envDefault:"200ms"`
+	// BreakerThreshold consecutive failed checks open the circuit for BreakerCooldown
+	BreakerThreshold int           `env:"SPELLER_BREAKER_THRESHOLD" envDefault:"5"`
+	BreakerCooldown  time.Duration `env:"SPELLER_BREAKER_COOLDOWN" envDefault:"30s"`
+	FailurePolicy    string        `env:"SPELLER_FAILURE_POLICY" envDefault:"closed"`
+	// OfflineFallback checks notes with the built-in offline checker while the speller is unavailable
+	OfflineFallback bool `env:"SPELLER_OFFLINE_FALLBACK" envDefault:"false"`
+
+	IgnoreDigits         bool `env:"SPELLER_IGNORE_DIGITS" envDefault:"false"`
+	IgnoreURLs           bool `env:"SPELLER_IGNORE_URLS" envDefault:"true"`
+	IgnoreCapitalization bool `env:"SPELLER_IGNORE_CAPITALIZATION" envDefault:"false"`
+
+	// CacheSize entries of results are kept for CacheTTL, 0 disables the cache
+	CacheSize int           `env:"SPELLER_CACHE_SIZE" envDefault:"10000"`
+	CacheTTL  time.Duration `env:"SPELLER_CACHE_TTL" envDefault:"1h"`
+	// CacheParagraphs checks and caches texts line by line
+	CacheParagraphs bool `env:"SPELLER_CACHE_PARAGRAPHS" envDefault:"false"`
+
+	CheckMode string `env:"GRAMMAR_CHECK_MODE" envDefault:"sync"`
+	// Workers poll the job queue every PollInterval while it is empty
+	Workers      int           `env:"GRAMMAR_WORKERS" envDefault:"2"`
+	PollInterval time.Duration `env:"GRAMMAR_POLL_INTERVAL" envDefault:"1s"`
+	// A failed job is retried after JobBackoff, doubling up to JobMaxAttempts attempts
+	JobMaxAttempts int           `env:"GRAMMAR_JOB_MAX_ATTEMPTS" envDefault:"5"`
+	JobBackoff     time.Duration `env:"GRAMMAR_JOB_BACKOFF" envDefault:"10s"`
+	// JobLease keeps other workers off a claimed job and bounds its check, it must exceed Timeout
+	JobLease time.Duration `env:"GRAMMAR_JOB_LEASE" envDefault:"1m"`
+}
@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+// Storage cache backends
+const (
+	CacheNone   = "none"
+	CacheMemory = "memory"
+	CacheRedis  = "redis"
+)
+
+type StorageCacheConfig struct {
+	Backend string `env:"STORAGE_CACHE" envDefault:"none"`
+	// Size bounds the entries of the memory backend
+	Size int           `env:"STORAGE_CACHE_SIZE" envDefault:"10000"`
+	TTL  time.Duration `env:"STORAGE_CACHE_TTL" envDefault:"5m"`
+
+	RedisAddr     string `env:"REDIS_ADDR" envDefault:"localhost:6379"`
+	RedisPassword string `env:"REDIS_PASSWORD"`
+	RedisDB       int    `env:"REDIS_DB" envDefault:"0"`
+}
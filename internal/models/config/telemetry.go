@@ -0,0 +1,8 @@
+package config
+
+type TelemetryConfig struct {
+	ServiceName   string  `env:"OTEL_SERVICE_NAME" envDefault:"kod"`
+	OtlpEndpoint  string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OtlpInsecure  bool    `env:"OTEL_EXPORTER_OTLP_INSECURE" envDefault:"false"`
+	SamplingRatio float64 `env:"OTEL_TRACES_SAMPLER_RATIO" envDefault:"1"`
+}
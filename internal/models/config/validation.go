@@ -0,0 +1,26 @@
+package config
+
+// Note validators
+const (
+	ValidatorLength    = "length"
+	ValidatorSpell     = "spell"
+	ValidatorProfanity = "profanity"
+	ValidatorLinks     = "links"
+	ValidatorSecrets   = "secrets"
+)
+
+type ValidationConfig struct {
+	// Validators run in this order on every new note
+	Validators []string `env:"NOTE_VALIDATORS" envDefault:"length,spell"`
+	// Policy maps validators to the action on their findings, the rest block high severity findings and warn about others
+	Policy map[string]string `env:"NOTE_POLICY"`
+
+	TitleMaxLength int `env:"NOTE_TITLE_MAX_LENGTH" envDefault:"200"`
+	TextMinLength  int `env:"NOTE_TEXT_MIN_LENGTH" envDefault:"1"`
+	TextMaxLength  int `env:"NOTE_TEXT_MAX_LENGTH" envDefault:"10000"`
+
+	// ProfanityFiles list words one per line, a trailing * matches any ending
+	ProfanityFiles []string `env:"NOTE_PROFANITY_FILES"`
+	// LinkAllowlist domains may be linked together with their subdomains
+	LinkAllowlist []string `env:"NOTE_LINK_ALLOWLIST"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// DictionaryWord is a word the grammar check accepts, the organization's when UserId is nil
+type DictionaryWord struct {
+	Id        int       `json:"id" db:"id"`
+	UserId    *int      `json:"-" db:"user_id"`
+	Word      string    `json:"word" db:"word"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type AddDictionaryWordRequest struct {
+	Word string `json:"word" validate:"required,max=64,word"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Identity links a user to the subject of an external OpenID Connect provider
+type Identity struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     *string   `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
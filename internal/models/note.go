@@ -2,11 +2,80 @@ package models
 
 import "time"
 
+// Grammar check statuses of a note
+const (
+	CheckPending = "pending"
+	CheckOk      = "ok"
+	CheckIssues  = "issues"
+	CheckFailed  = "failed"
+)
+
 type Note struct {
 	Id        int       `json:"id,omitempty" db:"id"`
 	UserId    int       `json:"user_id" db:"user_id"`
 	UserName  string    `json:"username" db:"username"`
-	Title     string    `json:"title" db:"title"`
-	Text      string    `json:"text" db:"text"`
+	Title     string    `json:"title" db:"title" validate:"required,max=200,utf8"`
+	Text      string    `json:"text" db:"text" validate:"required,max=10000,utf8"`
 	CreatedAt time.Time `json:"created_at,omitempty" db:"created_at"`
-}
\ No newline at end of file
+	// Unchecked is set when the note was saved while the speller was unavailable
+	Unchecked   bool            `json:"unchecked" db:"unchecked"`
+	CheckStatus string          `json:"check_status" db:"check_status"`
+	CheckIssues []SpellingIssue `json:"check_issues,omitempty" db:"check_issues"`
+	// Lang is the language the note is checked in, detected from the text when not given
+	Lang string `json:"lang" db:"lang" validate:"lang"`
+	// Findings the policy let through, they are only returned when the note is added
+	Findings []NoteFinding `json:"findings,omitempty" db:"-"`
+}
+
+// Severities of note findings
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// Actions the note policy takes on findings
+const (
+	ActionBlock  = "block"
+	ActionWarn   = "warn"
+	ActionRedact = "redact"
+)
+
+// NoteFinding is a problem a validator found in a field of a note.
+// Pos and Len locate it in runes, Len is 0 when it concerns the whole field.
+type NoteFinding struct {
+	Validator string `json:"validator"`
+	Code      string `json:"code"`
+	Field     string `json:"field"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	Pos       int    `json:"pos"`
+	Len       int    `json:"len"`
+	Action    string `json:"action,omitempty"`
+}
+
+// SpellingIssue is a mistake the speller found in a field of a note
+type SpellingIssue struct {
+	Field       string   `json:"field"`
+	Word        string   `json:"word"`
+	Pos         int      `json:"pos"`
+	Row         int      `json:"row"`
+	Col         int      `json:"col"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// GrammarJob is a queued grammar check of a note
+type GrammarJob struct {
+	Id       int
+	Note     Note
+	Attempts int
+}
+
+// GrammarJobOutcome tells the queue how a job ended: with a final check status,
+// or with CheckPending to be retried at RetryAt
+type GrammarJobOutcome struct {
+	Status  string
+	Issues  []SpellingIssue
+	RetryAt time.Time
+	Error   string
+}
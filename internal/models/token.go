@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// ApiToken is a personal token for scripts, only the hash of its secret is stored
+type ApiToken struct {
+	Id         int        `json:"id" db:"id"`
+	UserId     int        `json:"-" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Scope      string     `json:"scope" db:"scope"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+type CreateApiTokenRequest struct {
+	Name  string `json:"name" validate:"required,max=64,utf8"`
+	Scope string `json:"scope" validate:"required,oneof=read write"`
+	// ExpiresInDays leaves the token valid forever when zero
+	ExpiresInDays int `json:"expires_in_days" validate:"min=0,max=3650"`
+}
+
+// ApiTokenCreated carries the secret, which is shown only once
+type ApiTokenCreated struct {
+	ApiToken
+	Token string `json:"token"`
+}
@@ -1,7 +1,157 @@
 package models
 
+import "time"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User is the storage representation, Password holds the bcrypt hash and is never serialized
 type User struct {
-	Id       int    `json:"id" db:"id"`
-	Username string `json:"username" db:"username"`
-	Password string `json:"password" db:"password"`
-}
\ No newline at end of file
+	Id              int        `json:"id" db:"id"`
+	Username        string     `json:"username" db:"username"`
+	Password        string     `json:"-" db:"password"`
+	Email           *string    `json:"email,omitempty" db:"email"`
+	EmailVerifiedAt *time.Time `json:"-" db:"email_verified_at"`
+	DisplayName     *string    `json:"display_name,omitempty" db:"display_name"`
+	Timezone        string     `json:"timezone" db:"timezone"`
+	// Language is the default language of new notes, empty to detect it from the text
+	Language string `json:"language" db:"language"`
+	// TotpSecret is set at enrolment, it is only used for login once TotpEnabled
+	TotpSecret  *string    `json:"-" db:"totp_secret"`
+	TotpEnabled bool       `json:"-" db:"totp_enabled"`
+	Role        string     `json:"role" db:"role"`
+	DisabledAt  *time.Time `json:"-" db:"disabled_at"`
+	// SessionVersion is embedded in tokens, bumping it revokes every issued session
+	SessionVersion int `json:"-" db:"session_version"`
+}
+
+type SignUpRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=32,username"`
+	Password string `json:"password" validate:"required,password"`
+	Email    string `json:"email" validate:"omitempty,max=254,email"`
+	// Login sets the session cookie right after signup
+	Login bool `json:"login"`
+}
+
+type LogInRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// ReturnToken asks for the jwt in the response body instead of a cookie
+	ReturnToken bool `json:"return_token"`
+}
+
+// AccessToken is a session jwt handed to clients that send it in the Authorization header
+type AccessToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+	// Confirm must repeat the username
+	Confirm string `json:"confirm" validate:"required"`
+}
+
+// AccountExport is everything stored about a user, returned before deletion on request
+type AccountExport struct {
+	User  UserResponse `json:"user"`
+	Notes []Note       `json:"notes"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,max=254,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+// UpdateProfileRequest changes only the fields present, an empty email removes it
+// and an empty language makes new notes detect theirs
+type UpdateProfileRequest struct {
+	Email       *string `json:"email" validate:"omitempty,max=254,email"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=64,utf8"`
+	Timezone    *string `json:"timezone" validate:"omitempty,timezone"`
+	Language    *string `json:"language" validate:"omitempty,lang"`
+}
+
+// LogInChallenge is returned instead of a session when the user has two-factor authentication
+type LogInChallenge struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+}
+
+// MfaLogInRequest completes a login with either a TOTP code or a recovery code
+type MfaLogInRequest struct {
+	MfaToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+	ReturnToken  bool   `json:"return_token"`
+}
+
+type TotpEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TotpCodeRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type DisableTotpRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+type UserResponse struct {
+	Id            int     `json:"id"`
+	Username      string  `json:"username"`
+	Email         *string `json:"email,omitempty"`
+	EmailVerified bool    `json:"email_verified"`
+	DisplayName   *string `json:"display_name,omitempty"`
+	Timezone      string  `json:"timezone"`
+	Language      string  `json:"language"`
+	MfaEnabled    bool    `json:"mfa_enabled"`
+	Role          string  `json:"role"`
+}
+
+func NewUserResponse(u *User) UserResponse {
+	return UserResponse{
+		Id:            u.Id,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.Email != nil && u.EmailVerifiedAt != nil,
+		DisplayName:   u.DisplayName,
+		Timezone:      u.Timezone,
+		Language:      u.Language,
+		MfaEnabled:    u.TotpEnabled,
+		Role:          u.Role,
+	}
+}
+
+// UserSummary is the admin view of a user
+type UserSummary struct {
+	Id         int        `json:"id" db:"id"`
+	Username   string     `json:"username" db:"username"`
+	Email      *string    `json:"email,omitempty" db:"email"`
+	Role       string     `json:"role" db:"role"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
+	NoteCount  int        `json:"note_count" db:"note_count"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user admin"`
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+	"kod/internal/storage"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const adminPageSize = 50
+
+// AdminService lets admins inspect and manage other users' accounts
+type AdminService struct {
+	storage storage.Storage
+}
+
+func NewAdminService(s storage.Storage) *AdminService {
+	return &AdminService{storage: s}
+}
+
+// ListUsers pages through users matching the q query parameter, p is the page
+func (as *AdminService) ListUsers(r *http.Request) ([]models.UserSummary, error) {
+	ctx, span := tracer.Start(r.Context(), "service.ListUsers")
+	defer span.End()
+
+	page, err := strconv.Atoi(r.URL.Query().Get("p"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	search := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	search = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(search)
+
+	users, err := as.storage.ListUsers(ctx, search, (page-1)*adminPageSize, adminPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []models.UserSummary{}
+	}
+	return users, nil
+}
+
+func (as *AdminService) GetUser(ctx context.Context, userId int) (*models.UserSummary, error) {
+	ctx, span := tracer.Start(ctx, "service.GetUser")
+	defer span.End()
+
+	user, err := as.storage.GetUserSummary(ctx, userId)
+	if err != nil {
+		return nil, userNotFound(err)
+	}
+	return &user, nil
+}
+
+// SetDisabled disables or re-enables an account, disabled users can't log in and their sessions stop working
+func (as *AdminService) SetDisabled(ctx context.Context, userId int, disabled bool) error {
+	ctx, span := tracer.Start(ctx, "service.SetDisabled")
+	defer span.End()
+
+	if err := as.notSelf(ctx, userId); err != nil {
+		return err
+	}
+
+	return userNotFound(as.storage.SetUserDisabled(ctx, userId, disabled))
+}
+
+func (as *AdminService) SetRole(ctx context.Context, userId int, req *models.SetRoleRequest) error {
+	ctx, span := tracer.Start(ctx, "service.SetRole")
+	defer span.End()
+
+	if err := validateStruct(req); err != nil {
+		return err
+	}
+	if err := as.notSelf(ctx, userId); err != nil {
+		return err
+	}
+
+	return userNotFound(as.storage.SetUserRole(ctx, userId, req.Role))
+}
+
+// ForceLogOut revokes every session of a user
+func (as *AdminService) ForceLogOut(ctx context.Context, userId int) error {
+	ctx, span := tracer.Start(ctx, "service.ForceLogOut")
+	defer span.End()
+
+	return userNotFound(as.storage.RevokeSessions(ctx, userId))
+}
+
+// notSelf keeps admins from locking themselves out
+func (as *AdminService) notSelf(ctx context.Context, userId int) error {
+	admin, err := GetUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if admin.Id == userId {
+		return Forbidden("self_modification", "admins can't change their own account here")
+	}
+	return nil
+}
+
+func userNotFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFound("user_not_found", "user not found")
+	}
+	return err
+}
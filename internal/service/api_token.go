@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+	"kod/internal/storage"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ApiTokenPrefix marks personal API tokens, telling them apart from other bearer credentials
+const ApiTokenPrefix = "kod_"
+
+// ApiTokenService manages personal API tokens and authenticates requests made with them
+type ApiTokenService struct {
+	storage storage.Storage
+}
+
+func NewApiTokenService(s storage.Storage) *ApiTokenService {
+	return &ApiTokenService{storage: s}
+}
+
+// Create issues a token for the current user. Tokens can only be created from a login session,
+// so a leaked token can't be used to mint more.
+func (ts *ApiTokenService) Create(ctx context.Context, req *models.CreateApiTokenRequest) (*models.ApiTokenCreated, error) {
+	ctx, span := tracer.Start(ctx, "service.CreateApiToken")
+	defer span.End()
+
+	if err := validateStruct(req); err != nil {
+		return nil, err
+	}
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if GetAuthMethodFromContext(ctx) == AuthApiToken {
+		return nil, Forbidden("session_required", "API tokens can only be managed from a login session")
+	}
+
+	secret, _, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	secret = ApiTokenPrefix + secret
+
+	token := &models.ApiToken{
+		UserId: user.Id,
+		Name:   req.Name,
+		Scope:  req.Scope,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	newToken, err := ts.storage.AddApiToken(ctx, token, hashToken(secret))
+	if err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			return nil, Conflict("token_name_taken", "a token with this name already exists")
+		}
+		return nil, err
+	}
+
+	return &models.ApiTokenCreated{ApiToken: newToken, Token: secret}, nil
+}
+
+func (ts *ApiTokenService) List(ctx context.Context) ([]models.ApiToken, error) {
+	ctx, span := tracer.Start(ctx, "service.ListApiTokens")
+	defer span.End()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := ts.storage.ListApiTokens(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		tokens = []models.ApiToken{}
+	}
+	return tokens, nil
+}
+
+func (ts *ApiTokenService) Delete(ctx context.Context, tokenId int) error {
+	ctx, span := tracer.Start(ctx, "service.DeleteApiToken")
+	defer span.End()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if GetAuthMethodFromContext(ctx) == AuthApiToken {
+		return Forbidden("session_required", "API tokens can only be managed from a login session")
+	}
+
+	if err := ts.storage.DeleteApiToken(ctx, user.Id, tokenId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NotFound("token_not_found", "token not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// Authenticate resolves a bearer API token to its user.
+// Read-scoped tokens are limited to safe methods.
+func (ts *ApiTokenService) Authenticate(ctx context.Context, secret, method string) (*models.User, error) {
+	if !strings.HasPrefix(secret, ApiTokenPrefix) {
+		return nil, Unauthorized("token_invalid", "not an API token")
+	}
+
+	token, err := ts.storage.UseApiToken(ctx, hashToken(secret))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, Unauthorized("token_invalid", "API token is invalid or expired")
+		}
+		return nil, err
+	}
+
+	if token.Scope != models.ScopeWrite && !SafeMethod(method) {
+		return nil, Forbidden("insufficient_scope", "token scope doesn't allow writes")
+	}
+
+	user, err := ts.storage.GetUserById(ctx, token.UserId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, Unauthorized("token_invalid", "user no longer exists")
+		}
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, Unauthorized("account_disabled", "account is disabled")
+	}
+
+	return &user, nil
+}
+
+// SafeMethod reports whether an HTTP method is read-only
+func SafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
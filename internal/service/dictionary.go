@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/storage"
+	"os"
+	"strings"
+)
+
+// DictionaryService keeps the words the grammar check accepts: the user's own,
+// the organization's managed by admins and the organization's loaded from a file
+type DictionaryService struct {
+	storage   storage.Storage
+	fileWords map[string]struct{}
+}
+
+func NewDictionaryService(s storage.Storage, cfg *config.DictionaryConfig) (*DictionaryService, error) {
+	ds := &DictionaryService{storage: s, fileWords: make(map[string]struct{})}
+	if cfg.File == "" {
+		return ds, nil
+	}
+
+	f, err := os.Open(cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("service.NewDictionaryService: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		ds.fileWords[strings.ToLower(word)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("service.NewDictionaryService: %w", err)
+	}
+
+	return ds, nil
+}
+
+// List returns the words of the current user's dictionary
+func (ds *DictionaryService) List(ctx context.Context) ([]models.DictionaryWord, error) {
+	ctx, span := tracer.Start(ctx, "service.ListDictionaryWords")
+	defer span.End()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ds.list(ctx, &user.Id)
+}
+
+func (ds *DictionaryService) Add(ctx context.Context, req *models.AddDictionaryWordRequest) (*models.DictionaryWord, error) {
+	ctx, span := tracer.Start(ctx, "service.AddDictionaryWord")
+	defer span.End()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ds.add(ctx, &user.Id, req)
+}
+
+func (ds *DictionaryService) Delete(ctx context.Context, wordId int) error {
+	ctx, span := tracer.Start(ctx, "service.DeleteDictionaryWord")
+	defer span.End()
+
+	user, err := GetUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return ds.delete(ctx, &user.Id, wordId)
+}
+
+// ListOrg returns the organization's words managed by admins, the file's words aren't listed
+func (ds *DictionaryService) ListOrg(ctx context.Context) ([]models.DictionaryWord, error) {
+	ctx, span := tracer.Start(ctx, "service.ListOrgDictionaryWords")
+	defer span.End()
+
+	return ds.list(ctx, nil)
+}
+
+func (ds *DictionaryService) AddOrg(ctx context.Context, req *models.AddDictionaryWordRequest) (*models.DictionaryWord, error) {
+	ctx, span := tracer.Start(ctx, "service.AddOrgDictionaryWord")
+	defer span.End()
+
+	return ds.add(ctx, nil, req)
+}
+
+func (ds *DictionaryService) DeleteOrg(ctx context.Context, wordId int) error {
+	ctx, span := tracer.Start(ctx, "service.DeleteOrgDictionaryWord")
+	defer span.End()
+
+	return ds.delete(ctx, nil, wordId)
+}
+
+func (ds *DictionaryService) list(ctx context.Context, userId *int) ([]models.DictionaryWord, error) {
+	words, err := ds.storage.ListDictionaryWords(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if words == nil {
+		words = []models.DictionaryWord{}
+	}
+	return words, nil
+}
+
+func (ds *DictionaryService) add(ctx context.Context, userId *int, req *models.AddDictionaryWordRequest) (*models.DictionaryWord, error) {
+	req.Word = strings.TrimSpace(req.Word)
+	if err := validateStruct(req); err != nil {
+		return nil, err
+	}
+
+	word, err := ds.storage.AddDictionaryWord(ctx, userId, req.Word)
+	if err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			return nil, Conflict("word_exists", "the dictionary already has this word")
+		}
+		return nil, err
+	}
+	return &word, nil
+}
+
+func (ds *DictionaryService) delete(ctx context.Context, userId *int, wordId int) error {
+	if err := ds.storage.DeleteDictionaryWord(ctx, userId, wordId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NotFound("word_not_found", "word not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// Filter drops the issues about words in the user's or the organization's dictionaries
+func (ds *DictionaryService) Filter(ctx context.Context, userId int, issues []models.SpellingIssue) ([]models.SpellingIssue, error) {
+	if len(issues) == 0 {
+		return issues, nil
+	}
+
+	words, err := ds.storage.IgnoredWords(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	ignored := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		ignored[w] = struct{}{}
+	}
+
+	kept := issues[:0]
+	for _, issue := range issues {
+		word := strings.ToLower(issue.Word)
+		if _, ok := ds.fileWords[word]; ok {
+			continue
+		}
+		if _, ok := ignored[word]; ok {
+			continue
+		}
+		kept = append(kept, issue)
+	}
+	return kept, nil
+}
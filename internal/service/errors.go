@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds of the service layer. Every domain error wraps exactly one of them,
+// callers check the kind with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation failed")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUpstream     = errors.New("upstream failure")
+)
+
+// FieldError describes a single invalid input field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error with a stable machine-readable code
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+func NotFound(code, msg string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: msg}
+}
+
+func Conflict(code, msg string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: msg}
+}
+
+func Validation(code, msg string, fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Code: code, Message: msg, Fields: fields}
+}
+
+func Unauthorized(code, msg string) *Error {
+	return &Error{Kind: ErrUnauthorized, Code: code, Message: msg}
+}
+
+func Forbidden(code, msg string) *Error {
+	return &Error{Kind: ErrForbidden, Code: code, Message: msg}
+}
+
+func RateLimited(code, msg string) *Error {
+	return &Error{Kind: ErrRateLimited, Code: code, Message: msg}
+}
+
+func Upstream(code, msg string, err error) *Error {
+	return &Error{Kind: ErrUpstream, Code: code, Message: msg, Err: err}
+}
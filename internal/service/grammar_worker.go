@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/speller"
+	"kod/internal/storage"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// maxJobBackoff caps the delay between attempts of a grammar job
+const maxJobBackoff = time.Hour
+
+// GrammarWorker checks the notes queued by AddNote in async mode
+type GrammarWorker struct {
+	storage    storage.Storage
+	speller    speller.Checker
+	dictionary *DictionaryService
+	cfg        *config.SpellerConfig
+	zapLogger  *zap.SugaredLogger
+}
+
+func NewGrammarWorker(s storage.Storage, sc speller.Checker, ds *DictionaryService, c *config.SpellerConfig, l *zap.SugaredLogger) *GrammarWorker {
+	return &GrammarWorker{storage: s, speller: sc, dictionary: ds, cfg: c, zapLogger: l}
+}
+
+// Run processes the queue with cfg.Workers goroutines until ctx is done and they have finished their jobs
+func (gw *GrammarWorker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < gw.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gw.work(ctx)
+		}()
+	}
+	gw.zapLogger.Infof("grammar workers started: %d", gw.cfg.Workers)
+	wg.Wait()
+}
+
+// work drains the queue and polls it while it is empty
+func (gw *GrammarWorker) work(ctx context.Context) {
+	ticker := time.NewTicker(gw.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// A job in progress is finished even when shutdown begins
+		found, err := gw.storage.ProcessGrammarJob(context.WithoutCancel(ctx), gw.cfg.JobLease, gw.process)
+		if err != nil {
+			gw.zapLogger.Errorf("grammar job: %v", err)
+		}
+		if found && err == nil && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (gw *GrammarWorker) process(ctx context.Context, job *models.GrammarJob) models.GrammarJobOutcome {
+	ctx, span := tracer.Start(ctx, "service.GrammarJob")
+	defer span.End()
+	span.SetAttributes(attribute.Int("note.id", job.Note.Id), attribute.Int("job.attempt", job.Attempts+1))
+
+	issues, err := spellCheck(ctx, gw.speller, gw.dictionary, &job.Note)
+	if errors.Is(err, speller.ErrDegraded) {
+		// Offline results are kept only when the speller doesn't come back in time, the note stays unchecked
+		span.RecordError(err)
+		if job.Attempts+1 >= gw.cfg.JobMaxAttempts {
+			gw.zapLogger.Warnf("grammar check of note %d done offline: %v", job.Note.Id, err)
+			return models.GrammarJobOutcome{Status: models.CheckFailed, Issues: issues}
+		}
+		return models.GrammarJobOutcome{
+			Status:  models.CheckPending,
+			RetryAt: time.Now().Add(gw.backoff(job.Attempts)),
+			Error:   err.Error(),
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		if !errors.Is(err, speller.ErrUnavailable) || job.Attempts+1 >= gw.cfg.JobMaxAttempts {
+			gw.zapLogger.Warnf("grammar check of note %d failed: %v", job.Note.Id, err)
+			return models.GrammarJobOutcome{Status: models.CheckFailed}
+		}
+		return models.GrammarJobOutcome{
+			Status:  models.CheckPending,
+			RetryAt: time.Now().Add(gw.backoff(job.Attempts)),
+			Error:   err.Error(),
+		}
+	}
+
+	if len(issues) > 0 {
+		return models.GrammarJobOutcome{Status: models.CheckIssues, Issues: issues}
+	}
+	return models.GrammarJobOutcome{Status: models.CheckOk}
+}
+
+// backoff doubles JobBackoff with each attempt and spreads it by ±50%
+func (gw *GrammarWorker) backoff(attempts int) time.Duration {
+	d := gw.cfg.JobBackoff << attempts
+	if d <= 0 || d > maxJobBackoff {
+		d = maxJobBackoff
+	}
+	return d/2 + rand.N(d+1)
+}
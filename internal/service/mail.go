@@ -0,0 +1,22 @@
+package service
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"kod/internal/mail"
+	"time"
+)
+
+const mailTimeout = 30 * time.Second
+
+// sendInBackground delivers msg after the request has finished,
+// so response time doesn't depend on the mail relay
+func sendInBackground(ctx context.Context, m mail.Mailer, l *zap.SugaredLogger, msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailTimeout)
+		defer cancel()
+		if err := m.Send(ctx, msg); err != nil {
+			l.Errorf("sending %q mail: %v", msg.Subject, err)
+		}
+	}()
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/storage"
+	"kod/internal/totp"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet leaves out characters that are easy to misread
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	// mfaAttempts is how many codes a login challenge accepts before the password step has to be redone
+	mfaAttempts = 5
+)
+
+// MfaService enrols and removes TOTP two-factor authentication
+type MfaService struct {
+	storage storage.Storage
+	cfg     *config.AccountConfig
+}
+
+func NewMfaService(s storage.Storage, c *config.AccountConfig) *MfaService {
+	return &MfaService{storage: s, cfg: c}
+}
+
+// EnrollTotp generates a new secret, it takes effect once confirmed with a code from the app
+func (ms *MfaService) EnrollTotp(ctx context.Context) (*models.TotpEnrollment, error) {
+	ctx, span := tracer.Start(ctx, "service.EnrollTotp")
+	defer span.End()
+
+	user, err := loadCurrentUser(ctx, ms.storage)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, Conflict("mfa_enabled", "two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := ms.storage.SetTotpSecret(ctx, user.Id, secret); err != nil {
+		return nil, err
+	}
+
+	return &models.TotpEnrollment{
+		Secret: secret,
+		URI:    totp.URI(ms.cfg.TotpIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTotp enables TOTP when code matches the pending secret and returns fresh recovery codes.
+// The codes are shown only here, just their hashes are stored.
+func (ms *MfaService) ConfirmTotp(ctx context.Context, req *models.TotpCodeRequest) (*models.RecoveryCodes, error) {
+	ctx, span := tracer.Start(ctx, "service.ConfirmTotp")
+	defer span.End()
+
+	if err := validateStruct(req); err != nil {
+		return nil, err
+	}
+
+	user, err := loadCurrentUser(ctx, ms.storage)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, Conflict("mfa_enabled", "two-factor authentication is already enabled")
+	}
+	if user.TotpSecret == nil {
+		return nil, Validation("mfa_not_enrolled", "start the enrolment first")
+	}
+	if err := ms.checkCode(ctx, user, req.Code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := ms.storage.EnableTotp(ctx, user.Id, hashes); err != nil {
+		return nil, err
+	}
+
+	return &models.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableTotp turns two-factor authentication off, it asks for both factors
+func (ms *MfaService) DisableTotp(ctx context.Context, req *models.DisableTotpRequest) error {
+	ctx, span := tracer.Start(ctx, "service.DisableTotp")
+	defer span.End()
+
+	if err := validateStruct(req); err != nil {
+		return err
+	}
+
+	user, err := loadCurrentUser(ctx, ms.storage)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabled {
+		return Conflict("mfa_disabled", "two-factor authentication is not enabled")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return Validation("invalid_password", "password is incorrect",
+			FieldError{Field: "password", Message: "is incorrect"})
+	}
+	if err := ms.checkCode(ctx, user, req.Code); err != nil {
+		return err
+	}
+
+	return ms.storage.DisableTotp(ctx, user.Id)
+}
+
+// checkCode accepts each TOTP code at most once
+func (ms *MfaService) checkCode(ctx context.Context, user *models.User, code string) error {
+	invalid := Validation("invalid_mfa_code", "code is invalid",
+		FieldError{Field: "code", Message: "is invalid or already used"})
+
+	step, ok := totp.Validate(*user.TotpSecret, code, time.Now())
+	if !ok {
+		return invalid
+	}
+	if err := ms.storage.UseTotpStep(ctx, user.Id, step); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return invalid
+		}
+		return err
+	}
+
+	return nil
+}
+
+// VerifySecondFactor checks a TOTP code or, failing that, consumes a recovery code
+func (ms *MfaService) VerifySecondFactor(ctx context.Context, user *models.User, code, recoveryCode string) error {
+	if code != "" {
+		return ms.checkCode(ctx, user, code)
+	}
+
+	err := ms.storage.UseRecoveryCode(ctx, user.Id, hashToken(normalizeRecoveryCode(recoveryCode)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Validation("invalid_recovery_code", "recovery code is invalid",
+				FieldError{Field: "recovery_code", Message: "is invalid or already used"})
+		}
+		return err
+	}
+
+	return nil
+}
+
+// newMfaChallenge opens a second factor challenge for user's login, replacing any earlier one
+func newMfaChallenge(ctx context.Context, s storage.MfaStorage, ss *SessionService, user *models.User) (*models.LogInChallenge, error) {
+	challengeId, _, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.StartMfaChallenge(ctx, user.Id, challengeId); err != nil {
+		return nil, err
+	}
+
+	mfaToken, err := ss.CreateMfaToken(user, challengeId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LogInChallenge{MfaRequired: true, MfaToken: mfaToken}, nil
+}
+
+// newRecoveryCodes returns codes formatted as xxxxx-xxxxx and their hashes
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		for j := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = recoveryCodeAlphabet[n.Int64()]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
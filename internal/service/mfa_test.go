@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/storage"
+	"kod/internal/totp"
+	"testing"
+	"time"
+)
+
+// mfaStorage keeps a single user with TOTP enabled and their open challenge in memory
+type mfaStorage struct {
+	storage.Storage
+	user      models.User
+	lastStep  int64
+	challenge string
+	attempts  int
+}
+
+func (s *mfaStorage) GetUserById(ctx context.Context, userId int) (models.User, error) {
+	return s.user, nil
+}
+
+func (s *mfaStorage) UseTotpStep(ctx context.Context, userId int, step int64) error {
+	if step <= s.lastStep {
+		return pgx.ErrNoRows
+	}
+	s.lastStep = step
+	return nil
+}
+
+func (s *mfaStorage) StartMfaChallenge(ctx context.Context, userId int, challengeId string) error {
+	s.challenge, s.attempts = challengeId, 0
+	return nil
+}
+
+func (s *mfaStorage) UseMfaAttempt(ctx context.Context, userId int, challengeId string, maxAttempts int) error {
+	if s.challenge == "" || s.challenge != challengeId || s.attempts >= maxAttempts {
+		return pgx.ErrNoRows
+	}
+	s.attempts++
+	return nil
+}
+
+func (s *mfaStorage) EndMfaChallenge(ctx context.Context, userId int, challengeId string) error {
+	if s.challenge == "" || s.challenge != challengeId {
+		return pgx.ErrNoRows
+	}
+	s.challenge, s.attempts = "", 0
+	return nil
+}
+
+func newMfaTestService(t *testing.T) (*UserService, *mfaStorage) {
+	t.Helper()
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &mfaStorage{user: models.User{Id: 1, Username: "alice", TotpSecret: &secret, TotpEnabled: true}}
+	ss := NewSessionService(&config.SessionConfig{
+		CookieTTL:      time.Minute,
+		CookieName:     "jwt",
+		JwtTTL:         time.Minute,
+		JwtSecret:      "secret",
+		MfaTokenTTL:    time.Minute,
+		AuthTransports: []string{TransportCookie, TransportBearer},
+	})
+	return NewUserService(s, ss, NewMfaService(s, &config.AccountConfig{})), s
+}
+
+func wantCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) || serviceErr.Code != code {
+		t.Fatalf("got %v, want %s", err, code)
+	}
+}
+
+func TestLogInMfaVoidsChallengeAfterAttempts(t *testing.T) {
+	us, s := newMfaTestService(t)
+	challenge, err := newMfaChallenge(context.Background(), s, us.sessionService, &s.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The code of a step outside the window stands for a wrong guess
+	wrong, err := totp.Code(*s.user.TotpSecret, totp.Step(time.Now())-10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < mfaAttempts; i++ {
+		_, err := us.LogInMfa(context.Background(), &models.MfaLogInRequest{MfaToken: challenge.MfaToken, Code: wrong})
+		wantCode(t, err, "invalid_mfa_code")
+	}
+
+	code, err := totp.Code(*s.user.TotpSecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = us.LogInMfa(context.Background(), &models.MfaLogInRequest{MfaToken: challenge.MfaToken, Code: code})
+	wantCode(t, err, "mfa_token_invalid")
+}
+
+func TestLogInMfaAcceptsChallengeOnce(t *testing.T) {
+	us, s := newMfaTestService(t)
+	old, err := newMfaChallenge(context.Background(), s, us.sessionService, &s.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := newMfaChallenge(context.Background(), s, us.sessionService, &s.user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.Code(*s.user.TotpSecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = us.LogInMfa(context.Background(), &models.MfaLogInRequest{MfaToken: old.MfaToken, Code: code})
+	wantCode(t, err, "mfa_token_invalid")
+
+	if _, err := us.LogInMfa(context.Background(), &models.MfaLogInRequest{MfaToken: challenge.MfaToken, Code: code}); err != nil {
+		t.Fatalf("correct code: %v", err)
+	}
+
+	next, err := totp.Code(*s.user.TotpSecret, totp.Step(time.Now())+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = us.LogInMfa(context.Background(), &models.MfaLogInRequest{MfaToken: challenge.MfaToken, Code: next})
+	wantCode(t, err, "mfa_token_invalid")
+}
@@ -1,13 +1,14 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"github.com/opentracing/opentracing-go"
-	"io"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"kod/internal/lang"
 	"kod/internal/models"
+	"kod/internal/speller"
 	"kod/internal/storage"
 	"net/http"
 	"strconv"
@@ -16,23 +17,24 @@ import (
 
 const defaultLimit = 10
 
+var tracer = otel.Tracer("kod/internal/service")
+
 type NoteService struct {
-	storage storage.Storage
+	storage   storage.Storage
+	pipeline  *NotePipeline
+	zapLogger *zap.SugaredLogger
 }
 
-func NewNoteService(s storage.Storage) *NoteService {
-	return &NoteService{storage: s}
+func NewNoteService(s storage.Storage, np *NotePipeline, l *zap.SugaredLogger) *NoteService {
+	return &NoteService{storage: s, pipeline: np, zapLogger: l}
 }
 
 func (ns *NoteService) AddNote(r *http.Request, note *models.Note) (models.Note, error) {
-	span, ctx := opentracing.StartSpanFromContext(r.Context(), "service.AddNote")
-	defer span.Finish()
+	ctx, span := tracer.Start(r.Context(), "service.AddNote")
+	defer span.End()
 
-	if err := ns.checkGrammar(ctx, note.Title); err != nil {
-		return models.Note{}, fmt.Errorf("title grammar check failed: %v", err)
-	}
-	if err := ns.checkGrammar(ctx, note.Text); err != nil {
-		return models.Note{}, fmt.Errorf("text grammar check failed: %v", err)
+	if err := validateStruct(note); err != nil {
+		return models.Note{}, err
 	}
 
 	user, err := GetUserFromContext(ctx)
@@ -40,16 +42,40 @@ func (ns *NoteService) AddNote(r *http.Request, note *models.Note) (models.Note,
 		return models.Note{}, err
 	}
 
+	// An explicit language wins over the user's default, detection is the last resort
+	if note.Lang == "" {
+		note.Lang = user.Language
+	}
+	if note.Lang == "" {
+		note.Lang = lang.Detect(note.Title + "\n" + note.Text)
+	}
+	span.SetAttributes(attribute.String("note.lang", note.Lang))
+
 	note.UserId = user.Id
 	note.UserName = user.Username
+	// Check results come from the validators, not from the request
+	note.Unchecked, note.CheckStatus, note.CheckIssues, note.Findings = false, "", nil, nil
+	findings, err := ns.pipeline.Run(ctx, note)
+	if err != nil {
+		return models.Note{}, err
+	}
+	// Without the spell validator there is no check to wait for
+	if note.CheckStatus == "" {
+		note.CheckStatus = models.CheckOk
+	}
 	note.CreatedAt = time.Now()
 
-	return ns.storage.AddNote(ctx, note)
+	newNote, err := ns.storage.AddNote(ctx, note)
+	if err != nil {
+		return models.Note{}, err
+	}
+	newNote.Findings = findings
+	return newNote, nil
 }
 
 func (ns *NoteService) GetNotes(r *http.Request) ([]models.Note, error) {
-	span, ctx := opentracing.StartSpanFromContext(r.Context(), "service.GetNotes")
-	defer span.Finish()
+	ctx, span := tracer.Start(r.Context(), "service.GetNotes")
+	defer span.End()
 
 	pageParam := r.URL.Query().Get("p")
 	page, err := strconv.Atoi(pageParam)
@@ -67,42 +93,33 @@ func (ns *NoteService) GetNotes(r *http.Request) ([]models.Note, error) {
 	return ns.storage.GetNotes(ctx, user.Id, offset, limit)
 }
 
-func (ns *NoteService) checkGrammar(ctx context.Context, text string) error {
-	span, ctx := opentracing.StartSpanFromContext(ctx, "service.checkGrammar")
-	defer span.Finish()
-
-	if len(text) > 10000 {
-		return fmt.Errorf("text too long")
-	}
-	apiURL := "https://speller.yandex.net/services/spellservice.json/checkText"
-	requestBody := fmt.Sprintf("text=%s?options=%d?format=%s", text, 4, "plain")
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBufferString(requestBody))
-	if err != nil {
-		return fmt.Errorf("failed to create grammar check request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to perform grammar check: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read grammar check response: %w", err)
+// spellCheck checks the note's title and text in its language in one speller call,
+// words from the dictionaries of the note's author aren't reported.
+// Issues found by the offline fallback come with speller.ErrDegraded.
+func spellCheck(ctx context.Context, checker speller.Checker, dictionary *DictionaryService, note *models.Note) ([]models.SpellingIssue, error) {
+	fields := []string{"title", "text"}
+	mistakes, err := checker.CheckTexts(ctx, note.Lang, []string{note.Title, note.Text})
+	if err != nil && !errors.Is(err, speller.ErrDegraded) {
+		return nil, err
 	}
 
-	var grammarErrors []map[string]interface{}
-	err = json.Unmarshal(body, &grammarErrors)
-	if err != nil {
-		return fmt.Errorf("failed to parse grammar check response: %w", err)
+	var issues []models.SpellingIssue
+	for i, field := range fields {
+		for _, m := range mistakes[i] {
+			issues = append(issues, models.SpellingIssue{
+				Field:       field,
+				Word:        m.Word,
+				Pos:         m.Pos,
+				Row:         m.Row,
+				Col:         m.Col,
+				Suggestions: m.Suggestions,
+			})
+		}
 	}
 
-	if len(grammarErrors) > 0 {
-		return fmt.Errorf("%d grammar errors found in the note", len(grammarErrors))
+	issues, filterErr := dictionary.Filter(ctx, note.UserId, issues)
+	if filterErr != nil {
+		return nil, filterErr
 	}
-
-	return nil
-}
\ No newline at end of file
+	return issues, err
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"slices"
+	"unicode/utf8"
+)
+
+// NoteValidator checks a note before it is saved. It only reports findings,
+// what happens to the note is up to the policy. An error aborts adding the note.
+type NoteValidator interface {
+	Name() string
+	Validate(ctx context.Context, note *models.Note) ([]models.NoteFinding, error)
+}
+
+// NotePipeline runs a chain of validators and applies the policy to their findings
+type NotePipeline struct {
+	validators []NoteValidator
+	policy     map[string]string
+}
+
+// NewNotePipeline runs validators in order, policy maps validator names to actions
+func NewNotePipeline(policy map[string]string, validators ...NoteValidator) *NotePipeline {
+	return &NotePipeline{validators: validators, policy: policy}
+}
+
+// Run rejects the note if a finding is to be blocked. Otherwise it returns the findings that were let through,
+// with the redacted ones masked in the note.
+// Redacted and blocked spans are masked as soon as their validator returns, so the validators after it,
+// the speller and its cache among them, never see them. Findings and spelling issues of other validators
+// that overlap a masked span are dropped.
+func (np *NotePipeline) Run(ctx context.Context, note *models.Note) ([]models.NoteFinding, error) {
+	ctx, span := tracer.Start(ctx, "service.ValidateNote")
+	defer span.End()
+
+	var findings, masked []models.NoteFinding
+	for _, v := range np.validators {
+		found, err := v.Validate(ctx, note)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			f.Validator = v.Name()
+			f.Action = np.action(&f)
+			findings = append(findings, f)
+			// A blocked note isn't saved, masking it only keeps the content from the next validators
+			if f.Len > 0 && (f.Action == models.ActionRedact || f.Action == models.ActionBlock) {
+				redact(note, &f)
+				masked = append(masked, f)
+			}
+		}
+	}
+	findings = slices.DeleteFunc(findings, func(f models.NoteFinding) bool {
+		return maskedByOthers(masked, f.Validator, f.Field, f.Pos, f.Len)
+	})
+	dropMaskedIssues(note, masked)
+	span.SetAttributes(attribute.Int("note.findings", len(findings)))
+
+	var blocked, passed []models.NoteFinding
+	for _, f := range findings {
+		if f.Action == models.ActionBlock {
+			blocked = append(blocked, f)
+		} else {
+			passed = append(passed, f)
+		}
+	}
+	if len(blocked) > 0 {
+		// Notes rejected for spelling alone keep the error clients knew before the policy validators
+		policy := slices.ContainsFunc(blocked, func(f models.NoteFinding) bool { return f.Validator != config.ValidatorSpell })
+		if !policy {
+			return nil, Validation("grammar_errors", "grammar check failed", grammarErrors(blocked)...)
+		}
+		return nil, Validation("note_rejected", "note violates the content policy", findingErrors(blocked)...)
+	}
+
+	return passed, nil
+}
+
+// maskedByOthers reports whether the runes [pos, pos+n) of field overlap a span masked by another validator
+func maskedByOthers(masked []models.NoteFinding, validator, field string, pos, n int) bool {
+	for _, m := range masked {
+		if m.Validator != validator && m.Field == field && pos < m.Pos+m.Len && m.Pos < pos+n {
+			return true
+		}
+	}
+	return false
+}
+
+// dropMaskedIssues removes the spelling issues found in text masked by other validators,
+// a note left without issues is ok
+func dropMaskedIssues(note *models.Note, masked []models.NoteFinding) {
+	if len(masked) == 0 || len(note.CheckIssues) == 0 {
+		return
+	}
+	note.CheckIssues = slices.DeleteFunc(note.CheckIssues, func(issue models.SpellingIssue) bool {
+		return maskedByOthers(masked, config.ValidatorSpell, issue.Field, issue.Pos, utf8.RuneCountInString(issue.Word))
+	})
+	if len(note.CheckIssues) == 0 {
+		note.CheckIssues = nil
+		if note.CheckStatus == models.CheckIssues {
+			note.CheckStatus = models.CheckOk
+		}
+	}
+}
+
+// action is the configured action of the validator, or blocking high severity findings and warning about others.
+// A finding without a position can't be redacted and is blocked instead.
+func (np *NotePipeline) action(f *models.NoteFinding) string {
+	action, ok := np.policy[f.Validator]
+	switch {
+	case !ok && f.Severity == models.SeverityHigh:
+		return models.ActionBlock
+	case !ok:
+		return models.ActionWarn
+	case action == models.ActionRedact && f.Len == 0:
+		return models.ActionBlock
+	default:
+		return action
+	}
+}
+
+// findingErrors describes the findings with one error per field, validator and code
+func findingErrors(findings []models.NoteFinding) []FieldError {
+	type group struct{ field, validator, code string }
+	counts := make(map[group]int)
+	var groups []group
+	var messages []string
+	for _, f := range findings {
+		g := group{f.Field, f.Validator, f.Code}
+		if counts[g] == 0 {
+			groups = append(groups, g)
+			messages = append(messages, f.Message)
+		}
+		counts[g]++
+	}
+
+	fieldErrors := make([]FieldError, len(groups))
+	for i, g := range groups {
+		msg := messages[i]
+		if n := counts[g]; n > 1 {
+			msg = fmt.Sprintf("%s and %d more", msg, n-1)
+		}
+		fieldErrors[i] = FieldError{Field: g.field, Message: msg}
+	}
+	return fieldErrors
+}
+
+// grammarErrors counts the spelling findings with one error per field
+func grammarErrors(findings []models.NoteFinding) []FieldError {
+	counts := make(map[string]int)
+	var fields []string
+	for _, f := range findings {
+		if counts[f.Field] == 0 {
+			fields = append(fields, f.Field)
+		}
+		counts[f.Field]++
+	}
+
+	fieldErrors := make([]FieldError, len(fields))
+	for i, field := range fields {
+		msg := fmt.Sprintf("%d grammar errors found in the %s", counts[field], field)
+		fieldErrors[i] = FieldError{Field: field, Message: msg}
+	}
+	return fieldErrors
+}
+
+// redact replaces the runes of the finding with asterisks, keeping the positions of other findings valid
+func redact(note *models.Note, f *models.NoteFinding) {
+	var text *string
+	switch f.Field {
+	case "title":
+		text = &note.Title
+	case "text":
+		text = &note.Text
+	default:
+		return
+	}
+
+	runes := []rune(*text)
+	for i := f.Pos; i < f.Pos+f.Len && i < len(runes); i++ {
+		runes[i] = '*'
+	}
+	*text = string(runes)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"kod/internal/models"
+	"kod/internal/speller"
+	"testing"
+)
+
+// misspelled reports every occurrence of word as a mistake, at its position in runes like the speller does
+func misspelled(word string) checkerFunc {
+	return func(ctx context.Context, lang string, texts []string) ([][]speller.Mistake, error) {
+		mistakes := make([][]speller.Mistake, len(texts))
+		w := []rune(word)
+		for i, text := range texts {
+			runes := []rune(text)
+			for pos := 0; pos+len(w) <= len(runes); pos++ {
+				if string(runes[pos:pos+len(w)]) == word {
+					mistakes[i] = append(mistakes[i], speller.Mistake{Word: word, Pos: pos, Len: len(w)})
+				}
+			}
+		}
+		return mistakes, nil
+	}
+}
+
+func TestRunRejectionCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantCode string
+	}{
+		{"spelling only", "ашибка и ашибка", "grammar_errors"},
+		{"secret only", "password: hunter2", "note_rejected"},
+		{"spelling and secret", "ашибка password: hunter2", "note_rejected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			np := NewNotePipeline(nil, &secretsValidator{}, newSpellValidator(t, misspelled("ашибка")))
+
+			_, err := np.Run(context.Background(), &models.Note{Title: "Заметка", Text: tt.text, Lang: "ru"})
+			wantCode(t, err, tt.wantCode)
+		})
+	}
+}
+
+func TestRunGrammarErrorsCountMistakesPerField(t *testing.T) {
+	np := NewNotePipeline(nil, newSpellValidator(t, misspelled("ашибка")))
+
+	_, err := np.Run(context.Background(), &models.Note{Title: "ашибка", Text: "ашибка и ашибка", Lang: "ru"})
+	wantCode(t, err, "grammar_errors")
+
+	serviceErr := err.(*Error)
+	want := []FieldError{
+		{Field: "title", Message: "1 grammar errors found in the title"},
+		{Field: "text", Message: "2 grammar errors found in the text"},
+	}
+	if len(serviceErr.Fields) != len(want) {
+		t.Fatalf("errors = %+v, want %+v", serviceErr.Fields, want)
+	}
+	for i := range want {
+		if serviceErr.Fields[i] != want[i] {
+			t.Errorf("error %d = %+v, want %+v", i, serviceErr.Fields[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"kod/internal/lang"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/speller"
+	"kod/internal/util"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewNoteValidators builds the validators named in cfg in their order, except for secrets:
+// it always runs first, so a redacted or blocked secret is masked before any other validator sees the note.
+func NewNoteValidators(cfg *config.ValidationConfig, sc speller.Checker, ds *DictionaryService, spellerCfg *config.SpellerConfig, l *zap.SugaredLogger) ([]NoteValidator, error) {
+	validators := make([]NoteValidator, 0, len(cfg.Validators))
+	for _, name := range cfg.Validators {
+		switch name {
+		case config.ValidatorLength:
+			validators = append(validators, &lengthValidator{cfg: cfg})
+		case config.ValidatorSpell:
+			validators = append(validators, &spellValidator{speller: sc, dictionary: ds, cfg: spellerCfg, zapLogger: l})
+		case config.ValidatorProfanity:
+			v, err := newProfanityValidator(cfg.ProfanityFiles)
+			if err != nil {
+				return nil, err
+			}
+			validators = append(validators, v)
+		case config.ValidatorLinks:
+			validators = append(validators, &linksValidator{allowlist: cfg.LinkAllowlist})
+		case config.ValidatorSecrets:
+			validators = append([]NoteValidator{&secretsValidator{}}, validators...)
+		default:
+			return nil, fmt.Errorf("service.NewNoteValidators: unknown validator %q", name)
+		}
+	}
+	return validators, nil
+}
+
+// noteField is a checked field of a note under its name in findings
+type noteField struct {
+	name string
+	text string
+}
+
+func noteFields(note *models.Note) []noteField {
+	return []noteField{{"title", note.Title}, {"text", note.Text}}
+}
+
+// lengthValidator enforces the configured limits, which may be stricter than the storage ones
+type lengthValidator struct {
+	cfg *config.ValidationConfig
+}
+
+func (v *lengthValidator) Name() string {
+	return config.ValidatorLength
+}
+
+func (v *lengthValidator) Validate(_ context.Context, note *models.Note) ([]models.NoteFinding, error) {
+	var findings []models.NoteFinding
+	tooLong := func(field string, n, max int) {
+		if n > max {
+			findings = append(findings, models.NoteFinding{
+				Code:     "too_long",
+				Field:    field,
+				Severity: models.SeverityHigh,
+				Message:  fmt.Sprintf("must be at most %d characters long", max),
+			})
+		}
+	}
+
+	tooLong("title", utf8.RuneCountInString(note.Title), v.cfg.TitleMaxLength)
+	textLength := utf8.RuneCountInString(note.Text)
+	tooLong("text", textLength, v.cfg.TextMaxLength)
+	if textLength < v.cfg.TextMinLength {
+		findings = append(findings, models.NoteFinding{
+			Code:     "too_short",
+			Field:    "text",
+			Severity: models.SeverityHigh,
+			Message:  fmt.Sprintf("must be at least %d characters long", v.cfg.TextMinLength),
+		})
+	}
+	return findings, nil
+}
+
+// spellValidator checks the note with the speller, in async mode it only queues the check.
+// When the speller is unavailable it fails closed with an upstream error, or fails open marking the note unchecked.
+// A note checked by the offline fallback is saved unchecked too, its findings only warn.
+type spellValidator struct {
+	speller    speller.Checker
+	dictionary *DictionaryService
+	cfg        *config.SpellerConfig
+	zapLogger  *zap.SugaredLogger
+}
+
+func (v *spellValidator) Name() string {
+	return config.ValidatorSpell
+}
+
+func (v *spellValidator) Validate(ctx context.Context, note *models.Note) ([]models.NoteFinding, error) {
+	if v.cfg.CheckMode == config.CheckAsync {
+		note.CheckStatus = models.CheckPending
+		return nil, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "service.checkGrammar")
+	defer span.End()
+
+	issues, err := spellCheck(ctx, v.speller, v.dictionary, note)
+	degraded := errors.Is(err, speller.ErrDegraded)
+	if err != nil && !degraded {
+		if !errors.Is(err, speller.ErrUnavailable) {
+			return nil, err
+		}
+		if v.cfg.FailurePolicy == config.FailOpen {
+			span.RecordError(err)
+			span.SetAttributes(attribute.Bool("speller.fail_open", true))
+			util.LoggerFromContext(ctx, v.zapLogger).Warnf("saving note unchecked: %v", err)
+			note.Unchecked = true
+			note.CheckStatus = models.CheckFailed
+			return nil, nil
+		}
+		return nil, Upstream("speller_unavailable", "failed to perform grammar check", err)
+	}
+
+	severity := models.SeverityHigh
+	switch {
+	case degraded:
+		// Offline results are a guess, the note stays marked for a check by the speller
+		span.SetAttributes(attribute.Bool("speller.degraded", true))
+		util.LoggerFromContext(ctx, v.zapLogger).Warnf("saving note unchecked: %v", err)
+		note.Unchecked = true
+		note.CheckStatus = models.CheckFailed
+		severity = models.SeverityLow
+	case len(issues) > 0:
+		note.CheckStatus = models.CheckIssues
+	default:
+		note.CheckStatus = models.CheckOk
+	}
+	if len(issues) == 0 {
+		return nil, nil
+	}
+	note.CheckIssues = issues
+
+	findings := make([]models.NoteFinding, len(issues))
+	for i, issue := range issues {
+		findings[i] = models.NoteFinding{
+			Code:     "spelling",
+			Field:    issue.Field,
+			Severity: severity,
+			Message:  fmt.Sprintf("%q may be misspelled", issue.Word),
+			Pos:      issue.Pos,
+			Len:      utf8.RuneCountInString(issue.Word),
+		}
+	}
+	return findings, nil
+}
+
+// profanityValidator looks for words of the configured lists, entries ending with * match any ending
+type profanityValidator struct {
+	words map[string]struct{}
+	stems []string
+}
+
+func newProfanityValidator(files []string) (*profanityValidator, error) {
+	v := &profanityValidator{words: make(map[string]struct{})}
+	for _, name := range files {
+		if err := v.load(name); err != nil {
+			return nil, fmt.Errorf("service.newProfanityValidator: %w", err)
+		}
+	}
+	return v, nil
+}
+
+func (v *profanityValidator) load(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		switch {
+		case word == "" || strings.HasPrefix(word, "#"):
+		case strings.HasSuffix(word, "*"):
+			v.stems = append(v.stems, strings.TrimSuffix(word, "*"))
+		default:
+			v.words[word] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+func (v *profanityValidator) Name() string {
+	return config.ValidatorProfanity
+}
+
+func (v *profanityValidator) Validate(_ context.Context, note *models.Note) ([]models.NoteFinding, error) {
+	var findings []models.NoteFinding
+	for _, field := range noteFields(note) {
+		for _, w := range lang.Words(field.text) {
+			if !v.matches(strings.ToLower(w.Text)) {
+				continue
+			}
+			findings = append(findings, models.NoteFinding{
+				Code:     "profanity",
+				Field:    field.name,
+				Severity: models.SeverityMedium,
+				Message:  "contains profanity",
+				Pos:      w.Pos,
+				Len:      w.Len,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func (v *profanityValidator) matches(word string) bool {
+	if _, ok := v.words[word]; ok {
+		return true
+	}
+	for _, stem := range v.stems {
+		if strings.HasPrefix(word, stem) {
+			return true
+		}
+	}
+	return false
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'()]+`)
+
+// linksValidator reports links to domains outside the allowlist, subdomains of allowed domains are allowed
+type linksValidator struct {
+	allowlist []string
+}
+
+func (v *linksValidator) Name() string {
+	return config.ValidatorLinks
+}
+
+func (v *linksValidator) Validate(_ context.Context, note *models.Note) ([]models.NoteFinding, error) {
+	var findings []models.NoteFinding
+	for _, field := range noteFields(note) {
+		text := field.text
+		for _, loc := range linkPattern.FindAllStringIndex(text, -1) {
+			// Punctuation after a link usually ends the sentence
+			link := strings.TrimRight(text[loc[0]:loc[1]], ".,;:!?")
+			raw := link
+			if !strings.Contains(raw, "://") {
+				raw = "http://" + raw
+			}
+			u, err := url.Parse(raw)
+			host := ""
+			if err == nil {
+				host = strings.ToLower(u.Hostname())
+			}
+			if host != "" && v.allowed(host) {
+				continue
+			}
+
+			pos, length := runeSpan(text, loc[0], loc[0]+len(link))
+			findings = append(findings, models.NoteFinding{
+				Code:     "link_not_allowed",
+				Field:    field.name,
+				Severity: models.SeverityMedium,
+				Message:  fmt.Sprintf("links to %q aren't allowed", host),
+				Pos:      pos,
+				Len:      length,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func (v *linksValidator) allowed(host string) bool {
+	for _, domain := range v.allowlist {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretPatterns find credentials pasted into notes. When a pattern has a group only the group is the secret,
+// so redaction keeps e.g. the "password:" label.
+var secretPatterns = []struct {
+	code    string
+	message string
+	pattern *regexp.Regexp
+}{
+	{"private_key", "contains a private key",
+		regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----(?s:.*?-----END [A-Z0-9 ]*PRIVATE KEY-----)?`)},
+	{"aws_access_key", "contains an AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", "contains a GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,255}\b`)},
+	{"slack_token", "contains a Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"api_token", "contains an API token", regexp.MustCompile(`\b` + regexp.QuoteMeta(ApiTokenPrefix) + `[A-Za-z0-9_-]{20,}`)},
+	{"jwt", "contains a JSON Web Token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"password", "contains a password", regexp.MustCompile(`(?i)(?:password|passwd|pwd|пароль)\s*[:=]\s*(\S+)`)},
+}
+
+// secretsValidator reports credentials, the findings don't repeat the secrets
+type secretsValidator struct{}
+
+func (v *secretsValidator) Name() string {
+	return config.ValidatorSecrets
+}
+
+func (v *secretsValidator) Validate(ctx context.Context, note *models.Note) ([]models.NoteFinding, error) {
+	var findings []models.NoteFinding
+	for _, field := range noteFields(note) {
+		text := field.text
+		for _, p := range secretPatterns {
+			for _, loc := range p.pattern.FindAllStringSubmatchIndex(text, -1) {
+				start, end := loc[0], loc[1]
+				if len(loc) > 2 {
+					start, end = loc[2], loc[3]
+				}
+
+				pos, length := runeSpan(text, start, end)
+				findings = append(findings, models.NoteFinding{
+					Code:     p.code,
+					Field:    field.name,
+					Severity: models.SeverityHigh,
+					Message:  p.message,
+					Pos:      pos,
+					Len:      length,
+				})
+			}
+		}
+	}
+	if len(findings) > 0 {
+		trace.SpanFromContext(ctx).AddEvent("note.secrets", trace.WithAttributes(attribute.Int("count", len(findings))))
+	}
+	return findings, nil
+}
+
+// runeSpan converts byte offsets in text to a position and length in runes
+func runeSpan(text string, start, end int) (int, int) {
+	return utf8.RuneCountInString(text[:start]), utf8.RuneCountInString(text[start:end])
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/oauth2"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/storage"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// OidcStateCookie keeps the state of a login between the redirect to the provider and the callback
+const OidcStateCookie = "oidc_state"
+
+// provisionAttempts bounds the retries with a suffixed username when the derived one is taken
+const provisionAttempts = 5
+
+// OidcService logs users in with external OpenID Connect providers
+// using the authorization code flow with PKCE.
+// Providers are discovered on first use, so an unreachable provider doesn't stop the server.
+type OidcService struct {
+	storage        storage.Storage
+	sessionService *SessionService
+	cfg            *config.OidcConfig
+	client         *http.Client
+
+	mu        sync.Mutex
+	providers map[string]*oidcProvider
+}
+
+type oidcProvider struct {
+	oauth2        oauth2.Config
+	verifier      *oidc.IDTokenVerifier
+	autoProvision bool
+	linkByEmail   bool
+}
+
+// oidcIdentity holds the ID token claims used to link and provision users
+type oidcIdentity struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+func NewOidcService(s storage.Storage, ss *SessionService, c *config.OidcConfig) *OidcService {
+	return &OidcService{
+		storage:        s,
+		sessionService: ss,
+		cfg:            c,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		providers:      make(map[string]*oidcProvider),
+	}
+}
+
+// provider returns the named provider, fetching its discovery document on first use, a failed fetch is retried by the next login.
+// The lock isn't held while fetching, so a slow provider doesn't hold up logins with the others.
+func (oi *OidcService) provider(ctx context.Context, name string) (*oidcProvider, error) {
+	oi.mu.Lock()
+	p, ok := oi.providers[name]
+	oi.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	var cfg *config.OidcProvider
+	for i := range oi.cfg.Providers {
+		if oi.cfg.Providers[i].Name == name {
+			cfg = &oi.cfg.Providers[i]
+		}
+	}
+	if cfg == nil {
+		return nil, NotFound("provider_not_found", fmt.Sprintf("unknown identity provider: %s", name))
+	}
+
+	// The key set is fetched later with this context, it must outlive the request
+	discovered, err := oidc.NewProvider(oidc.ClientContext(context.WithoutCancel(ctx), oi.client), cfg.Issuer)
+	if err != nil {
+		return nil, Upstream("idp_unavailable", "identity provider is unavailable", err)
+	}
+
+	p = &oidcProvider{
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientId,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     discovered.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		},
+		verifier:      discovered.Verifier(&oidc.Config{ClientID: cfg.ClientId}),
+		autoProvision: cfg.AutoProvision,
+		linkByEmail:   cfg.LinkByEmail,
+	}
+
+	// Logins that raced to fetch the document share the first provider stored
+	oi.mu.Lock()
+	defer oi.mu.Unlock()
+	if stored, ok := oi.providers[name]; ok {
+		return stored, nil
+	}
+	oi.providers[name] = p
+
+	return p, nil
+}
+
+// PostLoginURL is where the browser goes after a successful login
+func (oi *OidcService) PostLoginURL() string {
+	return oi.cfg.PostLoginURL
+}
+
+// MfaURL is where the browser goes with a login challenged for the second factor.
+// The token is in the fragment, which browsers don't send to servers or in the Referer.
+func (oi *OidcService) MfaURL(challenge *models.LogInChallenge) string {
+	return oi.cfg.MfaURL + "#" + url.Values{"mfa_token": {challenge.MfaToken}}.Encode()
+}
+
+// Begin starts a login with provider. It returns the provider's authorization URL
+// and the cookie holding the signed state, nonce and PKCE verifier for the callback.
+func (oi *OidcService) Begin(ctx context.Context, provider string) (string, *http.Cookie, error) {
+	ctx, span := tracer.Start(ctx, "service.OidcBegin")
+	defer span.End()
+
+	if !oi.sessionService.AllowsTransport(TransportCookie) {
+		return "", nil, Validation("transport_disabled", "cookie sessions are disabled, single sign-on is unavailable")
+	}
+
+	p, err := oi.provider(ctx, provider)
+	if err != nil {
+		return "", nil, err
+	}
+
+	state, _, err := newSecretToken()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, _, err := newSecretToken()
+	if err != nil {
+		return "", nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	stateToken, err := oi.sessionService.CreateOidcStateToken(provider, state, nonce, verifier, oi.cfg.StateTTL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cookie := &http.Cookie{
+		Name:     OidcStateCookie,
+		Value:    stateToken,
+		Path:     "/auth/oidc/",
+		MaxAge:   int(oi.cfg.StateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	authURL := p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+
+	return authURL, cookie, nil
+}
+
+// Complete handles the provider's redirect back: it checks the state, redeems the code,
+// verifies the ID token and finds, links or provisions the user.
+// Like LogIn, users with two-factor authentication get a challenge instead of the session.
+func (oi *OidcService) Complete(ctx context.Context, provider string, query url.Values, stateToken string) (*Session, *models.LogInChallenge, error) {
+	ctx, span := tracer.Start(ctx, "service.OidcComplete")
+	defer span.End()
+
+	// Checked before the user is resolved, so a login that can't end in a session provisions no one
+	if !oi.sessionService.AllowsTransport(TransportCookie) {
+		return nil, nil, Validation("transport_disabled", "cookie sessions are disabled, single sign-on is unavailable")
+	}
+	if e := query.Get("error"); e != "" {
+		return nil, nil, Unauthorized("oidc_denied", fmt.Sprintf("identity provider refused the login: %s", e))
+	}
+
+	claims, err := oi.sessionService.ValidateOidcStateToken(stateToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.Provider != provider || subtle.ConstantTimeCompare([]byte(claims.State), []byte(query.Get("state"))) != 1 {
+		return nil, nil, Unauthorized("oidc_state_invalid", "login state is invalid or expired, start the login again")
+	}
+
+	p, err := oi.provider(ctx, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token, err := p.oauth2.Exchange(oidc.ClientContext(ctx, oi.client), query.Get("code"), oauth2.VerifierOption(claims.Verifier))
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			return nil, nil, Unauthorized("oidc_code_invalid", "authorization code was rejected")
+		}
+		return nil, nil, Upstream("idp_unavailable", "identity provider is unavailable", err)
+	}
+
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, Upstream("idp_bad_response", "identity provider returned no ID token", nil)
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIdToken)
+	if err != nil || subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(claims.Nonce)) != 1 {
+		return nil, nil, Unauthorized("oidc_token_invalid", "ID token is invalid")
+	}
+
+	var info oidcIdentity
+	if err := idToken.Claims(&info); err != nil {
+		return nil, nil, Upstream("idp_bad_response", "couldn't parse ID token claims", err)
+	}
+
+	user, err := oi.resolveUser(ctx, provider, p, idToken.Subject, &info)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, nil, Unauthorized("account_disabled", "account is disabled")
+	}
+
+	if user.TotpEnabled {
+		challenge, err := newMfaChallenge(ctx, oi.storage, oi.sessionService, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil
+	}
+
+	session, err := oi.sessionService.NewSession(user, TransportCookie)
+	return session, nil, err
+}
+
+// resolveUser returns the user linked to the identity. If the provider links by email, an unknown identity
+// with an address verified by the provider is linked to the local user who verified the same address,
+// otherwise a new user is provisioned.
+func (oi *OidcService) resolveUser(ctx context.Context, provider string, p *oidcProvider, subject string, info *oidcIdentity) (*models.User, error) {
+	user, err := oi.storage.GetUserByIdentity(ctx, provider, subject)
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	identity := &models.Identity{Provider: provider, Subject: subject}
+	var email string
+	if info.Email != "" {
+		identity.Email = &info.Email
+		if info.EmailVerified {
+			email = NormalizeEmail(info.Email)
+		}
+	}
+
+	if email != "" && p.linkByEmail {
+		existing, err := oi.storage.GetUserByEmail(ctx, email)
+		switch {
+		case err == nil:
+			identity.UserId = existing.Id
+			if err := oi.storage.AddIdentity(ctx, identity); err != nil && !errors.Is(err, storage.ErrAlreadyExists) {
+				return nil, err
+			}
+			return &existing, nil
+		case !errors.Is(err, pgx.ErrNoRows):
+			return nil, err
+		}
+	}
+
+	if !p.autoProvision {
+		return nil, Forbidden("oidc_not_linked", "no account is linked to this identity")
+	}
+
+	return oi.provision(ctx, identity, info, email)
+}
+
+// provision creates a user for identity. The user has no password and logs in with the provider,
+// one can be set later with the password reset flow.
+func (oi *OidcService) provision(ctx context.Context, identity *models.Identity, info *oidcIdentity, email string) (*models.User, error) {
+	base := oidcUsername(info)
+	user := &models.User{Username: base}
+	if name := strings.TrimSpace(info.Name); name != "" && utf8.RuneCountInString(name) <= 64 {
+		user.DisplayName = &name
+	}
+	if email != "" {
+		now := time.Now()
+		user.Email = &email
+		user.EmailVerifiedAt = &now
+	}
+
+	for attempt := 0; attempt < provisionAttempts; attempt++ {
+		newUser, err := oi.storage.AddUserWithIdentity(ctx, user, identity)
+		if err == nil {
+			return &newUser, nil
+		}
+
+		switch storage.ViolatedConstraint(err) {
+		case storage.ConstraintUsername:
+			suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return nil, err
+			}
+			user.Username = fmt.Sprintf("%s-%04d", base, suffix)
+		case storage.ConstraintEmail:
+			user.Email, user.EmailVerifiedAt = nil, nil
+		case storage.ConstraintIdentity:
+			// A concurrent callback for the same identity got there first
+			linked, err := oi.storage.GetUserByIdentity(ctx, identity.Provider, identity.Subject)
+			if err != nil {
+				return nil, err
+			}
+			return &linked, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, Conflict("user_exists", "couldn't find a free username for the identity")
+}
+
+// oidcUsername derives a valid username from the preferred username or the email's local part
+func oidcUsername(info *oidcIdentity) string {
+	candidate := info.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(info.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range NormalizeUsername(candidate) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+		case b.Len() > 0 && (r == '.' || r == '_' || r == '-'):
+		default:
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	// Leave room for the suffix added on conflict
+	username := b.String()
+	for utf8.RuneCountInString(username) > 27 {
+		_, size := utf8.DecodeLastRuneInString(username)
+		username = username[:len(username)-size]
+	}
+	if utf8.RuneCountInString(username) < 3 {
+		username = "user"
+	}
+
+	return username
+}
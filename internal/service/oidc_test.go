@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/storage"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientId = "kod"
+
+// testIdP is an OpenID Connect provider serving discovery, the key set and the token endpoint.
+// Tests play the browser and the user: authorize hands out a code for the login started by Begin.
+type testIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu        sync.Mutex
+	grants    map[string]idpGrant
+	verifiers []string
+}
+
+type idpGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key, grants: make(map[string]idpGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// token redeems a code, checking the PKCE verifier against the challenge of its authorization request
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	verifier := r.PostForm.Get("code_verifier")
+	idp.verifiers = append(idp.verifiers, verifier)
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(verifier))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss": idp.server.URL,
+		"aud": testClientId,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		writeTestJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeTestJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// authorize approves the login redirected to authURL with the ID token claims of the user.
+// It returns the query the provider redirects back with. The nonce is the requested one unless claims set it.
+func (idp *testIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) url.Values {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without an S256 PKCE challenge: %s", authURL)
+	}
+
+	grant := idpGrant{challenge: q.Get("code_challenge"), claims: jwt.MapClaims{"nonce": q.Get("nonce")}}
+	for k, v := range claims {
+		grant.claims[k] = v
+	}
+	code, _, err := newSecretToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	idp.grants[code] = grant
+	idp.mu.Unlock()
+
+	return url.Values{"code": {code}, "state": {q.Get("state")}}
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// oidcStorage keeps users and their identities in memory
+type oidcStorage struct {
+	storage.Storage
+	users      []models.User
+	identities map[string]int
+}
+
+func (s *oidcStorage) GetUserByIdentity(ctx context.Context, provider, subject string) (models.User, error) {
+	if id, ok := s.identities[provider+"/"+subject]; ok {
+		return s.users[id-1], nil
+	}
+	return models.User{}, pgx.ErrNoRows
+}
+
+func (s *oidcStorage) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	for _, user := range s.users {
+		if user.Email != nil && *user.Email == email && user.EmailVerifiedAt != nil {
+			return user, nil
+		}
+	}
+	return models.User{}, pgx.ErrNoRows
+}
+
+func (s *oidcStorage) AddIdentity(ctx context.Context, identity *models.Identity) error {
+	s.identities[identity.Provider+"/"+identity.Subject] = identity.UserId
+	return nil
+}
+
+func (s *oidcStorage) AddUserWithIdentity(ctx context.Context, user *models.User, identity *models.Identity) (models.User, error) {
+	newUser := *user
+	newUser.Id = len(s.users) + 1
+	s.users = append(s.users, newUser)
+	s.identities[identity.Provider+"/"+identity.Subject] = newUser.Id
+	return newUser, nil
+}
+
+func newOidcTestService(idp *testIdP, linkByEmail bool, users ...models.User) (*OidcService, *oidcStorage) {
+	s := &oidcStorage{users: users, identities: make(map[string]int)}
+	ss := NewSessionService(&config.SessionConfig{
+		CookieTTL:      time.Minute,
+		CookieName:     "jwt",
+		JwtTTL:         time.Minute,
+		JwtSecret:      "secret",
+		AuthTransports: []string{TransportCookie},
+	})
+	oi := NewOidcService(s, ss, &config.OidcConfig{
+		Providers: []config.OidcProvider{{
+			Name:          "idp",
+			Issuer:        idp.server.URL,
+			ClientId:      testClientId,
+			ClientSecret:  "secret",
+			Scopes:        []string{"openid", "email"},
+			RedirectURL:   "http://kod.test/auth/oidc/idp/callback",
+			AutoProvision: true,
+			LinkByEmail:   linkByEmail,
+		}},
+		StateTTL: time.Minute,
+	})
+	return oi, s
+}
+
+func aliceClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "alice-sub", "email": "Alice@Example.com", "email_verified": true, "preferred_username": "Alice"}
+}
+
+func TestOidcProvisionsUserOnFirstLogin(t *testing.T) {
+	idp := newTestIdP(t)
+	oi, s := newOidcTestService(idp, false)
+
+	for i := 0; i < 2; i++ {
+		authURL, cookie, err := oi.Begin(context.Background(), "idp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, challenge, err := oi.Complete(context.Background(), "idp", idp.authorize(t, authURL, aliceClaims()), cookie.Value)
+		if err != nil {
+			t.Fatalf("login %d: %v", i+1, err)
+		}
+		if challenge != nil || session == nil || session.Cookie == nil {
+			t.Fatalf("login %d: got no session cookie", i+1)
+		}
+	}
+
+	if len(s.users) != 1 {
+		t.Fatalf("%d users provisioned, want 1", len(s.users))
+	}
+	user := s.users[0]
+	if user.Username != "alice" || user.Email == nil || *user.Email != "alice@example.com" || user.EmailVerifiedAt == nil {
+		t.Errorf("provisioned %+v, want alice with the verified alice@example.com", user)
+	}
+}
+
+func TestOidcSendsPkceVerifier(t *testing.T) {
+	idp := newTestIdP(t)
+	oi, _ := newOidcTestService(idp, false)
+
+	authURL, cookie, err := oi.Begin(context.Background(), "idp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := idp.authorize(t, authURL, aliceClaims())
+	if _, _, err := oi.Complete(context.Background(), "idp", query, cookie.Value); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(authURL)
+	if len(idp.verifiers) != 1 {
+		t.Fatalf("token endpoint called %d times, want 1", len(idp.verifiers))
+	}
+	sum := sha256.Sum256([]byte(idp.verifiers[0]))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != u.Query().Get("code_challenge") {
+		t.Errorf("verifier %q doesn't match the challenge", idp.verifiers[0])
+	}
+}
+
+func TestOidcRejectsStateOfAnotherLogin(t *testing.T) {
+	idp := newTestIdP(t)
+	oi, s := newOidcTestService(idp, false)
+
+	_, cookie, err := oi.Begin(context.Background(), "idp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherURL, _, err := oi.Begin(context.Background(), "idp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = oi.Complete(context.Background(), "idp", idp.authorize(t, otherURL, aliceClaims()), cookie.Value)
+	wantCode(t, err, "oidc_state_invalid")
+	if len(idp.verifiers) != 0 || len(s.users) != 0 {
+		t.Errorf("code redeemed %d times and %d users provisioned, want none", len(idp.verifiers), len(s.users))
+	}
+}
+
+func TestOidcRejectsNonceMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	oi, s := newOidcTestService(idp, false)
+
+	authURL, cookie, err := oi.Begin(context.Background(), "idp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := aliceClaims()
+	claims["nonce"] = "replayed"
+
+	_, _, err = oi.Complete(context.Background(), "idp", idp.authorize(t, authURL, claims), cookie.Value)
+	wantCode(t, err, "oidc_token_invalid")
+	if len(s.users) != 0 {
+		t.Errorf("%d users provisioned, want none", len(s.users))
+	}
+}
+
+func TestOidcLinksByEmailOnlyWhenEnabled(t *testing.T) {
+	email := "alice@example.com"
+	verified := time.Now()
+	existing := models.User{Id: 1, Username: "alice", Email: &email, EmailVerifiedAt: &verified}
+
+	tests := []struct {
+		name        string
+		linkByEmail bool
+		wantUserId  int
+	}{
+		{"disabled", false, 2},
+		{"enabled", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			oi, s := newOidcTestService(idp, tt.linkByEmail, existing)
+
+			authURL, cookie, err := oi.Begin(context.Background(), "idp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := oi.Complete(context.Background(), "idp", idp.authorize(t, authURL, aliceClaims()), cookie.Value); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := s.identities["idp/alice-sub"]; got != tt.wantUserId {
+				t.Errorf("identity linked to user %d, want %d", got, tt.wantUserId)
+			}
+		})
+	}
+}
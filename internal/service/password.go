@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"kod/internal/mail"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/storage"
+	"net/url"
+	"time"
+)
+
+// PasswordService implements the forgotten password flow.
+// Reset tokens are random, single-use, expire after cfg.ResetTokenTTL
+// and only their SHA-256 is stored.
+type PasswordService struct {
+	storage   storage.Storage
+	mailer    mail.Mailer
+	cfg       *config.AccountConfig
+	zapLogger *zap.SugaredLogger
+}
+
+func NewPasswordService(s storage.Storage, m mail.Mailer, c *config.AccountConfig, l *zap.SugaredLogger) *PasswordService {
+	return &PasswordService{storage: s, mailer: m, cfg: c, zapLogger: l}
+}
+
+// Forgot mails a reset link when the email belongs to a user and is verified.
+// It reports success either way, so callers can't probe which emails are registered:
+// the token is made up front and the lookup, storing and mailing go on in the background,
+// so both branches cost the caller the same.
+func (ps *PasswordService) Forgot(ctx context.Context, req *models.ForgotPasswordRequest) error {
+	ctx, span := tracer.Start(ctx, "service.Forgot")
+	defer span.End()
+
+	if err := validateStruct(req); err != nil {
+		return err
+	}
+
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+
+	go ps.sendReset(context.WithoutCancel(ctx), NormalizeEmail(req.Email), token, tokenHash)
+
+	return nil
+}
+
+// sendReset stores the reset token and mails the link if email is a user's verified email
+func (ps *PasswordService) sendReset(ctx context.Context, email, token, tokenHash string) {
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+
+	user, err := ps.storage.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			ps.zapLogger.Errorf("password reset: %v", err)
+		}
+		return
+	}
+	if user.EmailVerifiedAt == nil {
+		return
+	}
+
+	if err := ps.storage.AddResetToken(ctx, user.Id, tokenHash, time.Now().Add(ps.cfg.ResetTokenTTL)); err != nil {
+		ps.zapLogger.Errorf("password reset: %v", err)
+		return
+	}
+
+	msg := mail.Message{
+		To:      *user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hi %s,\n\nuse this link to set a new password, it is valid for %s:\n%s\n\n"+
+			"If you didn't ask for a reset, ignore this message.\n",
+			user.Username, ps.cfg.ResetTokenTTL, ps.resetLink(token)),
+	}
+	if err := ps.mailer.Send(ctx, msg); err != nil {
+		ps.zapLogger.Errorf("sending %q mail: %v", msg.Subject, err)
+	}
+}
+
+// Reset sets a new password using a reset token and revokes all sessions of the user
+func (ps *PasswordService) Reset(ctx context.Context, req *models.ResetPasswordRequest) error {
+	ctx, span := tracer.Start(ctx, "service.Reset")
+	defer span.End()
+
+	if err := validateStruct(req); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ps.storage.ResetPassword(ctx, hashToken(req.Token), string(hash)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Validation("invalid_reset_token", "reset token is invalid, used or expired",
+				FieldError{Field: "token", Message: "is invalid, used or expired"})
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (ps *PasswordService) resetLink(token string) string {
+	return fmt.Sprintf("%s/password/reset?token=%s", ps.cfg.BaseURL, url.QueryEscape(token))
+}
+
+// newSecretToken returns a random url-safe token and the hash to store instead of it
+func newSecretToken() (token string, tokenHash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
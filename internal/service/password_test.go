@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"kod/internal/mail"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/storage"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMailer hands the sent messages to the test
+type fakeMailer struct {
+	sent chan mail.Message
+}
+
+func newFakeMailer() *fakeMailer {
+	return &fakeMailer{sent: make(chan mail.Message, 10)}
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// next waits for the next message
+func (m *fakeMailer) next(t *testing.T) mail.Message {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail sent")
+		return mail.Message{}
+	}
+}
+
+// none checks that no message comes shortly after
+func (m *fakeMailer) none(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		t.Fatalf("mail sent to %s", msg.To)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// linkToken returns the token of the link to path in msg
+func linkToken(t *testing.T, msg mail.Message, path string) string {
+	t.Helper()
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if u, err := url.Parse(line); err == nil && u.Path == path {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("no %s link in %q", path, msg.Body)
+	return ""
+}
+
+type resetToken struct {
+	userId    int
+	expiresAt time.Time
+	used      bool
+}
+
+// accountStorage keeps users and reset tokens in memory like the database does.
+// Email lookups are handed to the test, elapsed moves the clock the tokens expire by.
+type accountStorage struct {
+	storage.Storage
+	lookups chan string
+
+	mu      sync.Mutex
+	users   []models.User
+	resets  map[string]*resetToken
+	elapsed time.Duration
+}
+
+func newAccountStorage(users ...models.User) *accountStorage {
+	return &accountStorage{lookups: make(chan string), users: users, resets: make(map[string]*resetToken)}
+}
+
+func (s *accountStorage) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	s.lookups <- email
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email != nil && *user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, pgx.ErrNoRows
+}
+
+func (s *accountStorage) AddResetToken(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resets[tokenHash] = &resetToken{userId: userId, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *accountStorage) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reset, ok := s.resets[tokenHash]
+	if !ok || reset.used || !time.Now().Add(s.elapsed).Before(reset.expiresAt) {
+		return models.User{}, pgx.ErrNoRows
+	}
+	for _, r := range s.resets {
+		if r.userId == reset.userId {
+			r.used = true
+		}
+	}
+	user := &s.users[reset.userId-1]
+	user.Password = passwordHash
+	return *user, nil
+}
+
+func (s *accountStorage) VerifyEmail(ctx context.Context, userId int, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := &s.users[userId-1]
+	if user.Email == nil || *user.Email != email {
+		return pgx.ErrNoRows
+	}
+	verified := time.Now()
+	user.EmailVerifiedAt = &verified
+	return nil
+}
+
+func testAccountConfig() *config.AccountConfig {
+	return &config.AccountConfig{BaseURL: "http://kod.test", ResetTokenTTL: 30 * time.Minute, VerifyEmailTTL: time.Hour}
+}
+
+// testUsers are alice with a verified email and bob with an unverified one
+func testUsers() []models.User {
+	alice, bob := "alice@example.com", "bob@example.com"
+	verified := time.Now()
+	return []models.User{
+		{Id: 1, Username: "alice", Email: &alice, EmailVerifiedAt: &verified, Password: "old"},
+		{Id: 2, Username: "bob", Email: &bob, Password: "old"},
+	}
+}
+
+// TestForgotAnswersAlike checks that Forgot gives the same answer whoever the email belongs to
+// and returns before the user is looked up, while only a verified email gets the link
+func TestForgotAnswersAlike(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		wantMail bool
+	}{
+		{"verified", "Alice@Example.com", true},
+		{"unverified", "bob@example.com", false},
+		{"unknown", "eve@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, m := newAccountStorage(testUsers()...), newFakeMailer()
+			ps := NewPasswordService(s, m, testAccountConfig(), zap.NewNop().Sugar())
+
+			// The lookup blocks until the test takes it, so Forgot can't have waited for it
+			if err := ps.Forgot(context.Background(), &models.ForgotPasswordRequest{Email: tt.email}); err != nil {
+				t.Fatalf("got %v, want nil", err)
+			}
+			if email := <-s.lookups; email != NormalizeEmail(tt.email) {
+				t.Errorf("looked up %q, want %q", email, NormalizeEmail(tt.email))
+			}
+
+			if !tt.wantMail {
+				m.none(t)
+				return
+			}
+			if msg := m.next(t); msg.To != "alice@example.com" {
+				t.Errorf("mail sent to %s, want alice@example.com", msg.To)
+			}
+		})
+	}
+}
+
+// forgot asks for a reset link for alice and returns its token
+func forgot(t *testing.T, ps *PasswordService, s *accountStorage, m *fakeMailer) string {
+	t.Helper()
+	if err := ps.Forgot(context.Background(), &models.ForgotPasswordRequest{Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	<-s.lookups
+	return linkToken(t, m.next(t), "/password/reset")
+}
+
+func TestResetTokenIsSingleUse(t *testing.T) {
+	s, m := newAccountStorage(testUsers()...), newFakeMailer()
+	ps := NewPasswordService(s, m, testAccountConfig(), zap.NewNop().Sugar())
+
+	token := forgot(t, ps, s, m)
+	if _, ok := s.resets[token]; ok {
+		t.Error("reset token stored in the clear")
+	}
+
+	if err := ps.Reset(context.Background(), &models.ResetPasswordRequest{Token: token, Password: "newpassword1"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.users[0].Password == "old" {
+		t.Error("password not changed")
+	}
+
+	err := ps.Reset(context.Background(), &models.ResetPasswordRequest{Token: token, Password: "newpassword2"})
+	wantCode(t, err, "invalid_reset_token")
+}
+
+func TestResetTokenExpires(t *testing.T) {
+	s, m := newAccountStorage(testUsers()...), newFakeMailer()
+	cfg := testAccountConfig()
+	ps := NewPasswordService(s, m, cfg, zap.NewNop().Sugar())
+
+	token := forgot(t, ps, s, m)
+	s.mu.Lock()
+	s.elapsed = cfg.ResetTokenTTL + time.Second
+	s.mu.Unlock()
+
+	err := ps.Reset(context.Background(), &models.ResetPasswordRequest{Token: token, Password: "newpassword1"})
+	wantCode(t, err, "invalid_reset_token")
+	if s.users[0].Password != "old" {
+		t.Error("password changed with an expired token")
+	}
+}
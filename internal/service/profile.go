@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"kod/internal/mail"
+	"kod/internal/models"
+	"kod/internal/models/config"
+	"kod/internal/storage"
+	"net/url"
+)
+
+// ProfileService manages account details and email verification.
+// Verification links carry a signed, expiring token bound to the user and the address.
+type ProfileService struct {
+	storage        storage.Storage
+	sessionService *SessionService
+	mailer         mail.Mailer
+	cfg            *config.AccountConfig
+	zapLogger      *zap.SugaredLogger
+}
+
+func NewProfileService(s storage.Storage, ss *SessionService, m mail.Mailer, c *config.AccountConfig, l *zap.SugaredLogger) *ProfileService {
+	return &ProfileService{storage: s, sessionService: ss, mailer: m, cfg: c, zapLogger: l}
+}
+
+func (ps *ProfileService) GetProfile(ctx context.Context) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "service.GetProfile")
+	defer span.End()
+
+	return ps.currentUser(ctx)
+}
+
+// UpdateProfile applies the fields present in req.
+// A changed email becomes unverified and a verification link is sent to it.
+func (ps *ProfileService) UpdateProfile(ctx context.Context, req *models.UpdateProfileRequest) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "service.UpdateProfile")
+	defer span.End()
+
+	// An empty email is a removal, not an invalid address
+	removeEmail := req.Email != nil && NormalizeEmail(*req.Email) == ""
+	if removeEmail {
+		req.Email = nil
+	}
+	if err := validateStruct(req); err != nil {
+		return nil, err
+	}
+
+	user, err := ps.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	emailChanged := false
+	switch {
+	case removeEmail:
+		emailChanged = user.Email != nil
+		user.Email = nil
+	case req.Email != nil:
+		email := NormalizeEmail(*req.Email)
+		if user.Email == nil || *user.Email != email {
+			emailChanged = true
+			user.Email = &email
+		}
+	}
+	if emailChanged {
+		user.EmailVerifiedAt = nil
+	}
+	if req.DisplayName != nil {
+		user.DisplayName = req.DisplayName
+		if *req.DisplayName == "" {
+			user.DisplayName = nil
+		}
+	}
+	if req.Timezone != nil {
+		user.Timezone = *req.Timezone
+	}
+	if req.Language != nil {
+		user.Language = *req.Language
+	}
+
+	updated, err := ps.storage.UpdateProfile(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if emailChanged && updated.Email != nil {
+		if err := ps.SendVerification(ctx, &updated); err != nil {
+			return nil, err
+		}
+	}
+
+	return &updated, nil
+}
+
+// ResendVerification mails a new verification link for the current, unverified email
+func (ps *ProfileService) ResendVerification(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "service.ResendVerification")
+	defer span.End()
+
+	user, err := ps.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+	if user.Email == nil {
+		return Validation("email_missing", "account has no email",
+			FieldError{Field: "email", Message: "is not set"})
+	}
+	if user.EmailVerifiedAt != nil {
+		return Conflict("email_verified", "email is already verified")
+	}
+
+	return ps.SendVerification(ctx, user)
+}
+
+// SendVerification mails user a signed link confirming their email
+func (ps *ProfileService) SendVerification(ctx context.Context, user *models.User) error {
+	token, err := ps.sessionService.CreateEmailToken(user.Id, *user.Email, ps.cfg.VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/email/verify?token=%s", ps.cfg.BaseURL, url.QueryEscape(token))
+	sendInBackground(ctx, ps.mailer, ps.zapLogger, mail.Message{
+		To:      *user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hi %s,\n\nconfirm this address by opening the link, it is valid for %s:\n%s\n",
+			user.Username, ps.cfg.VerifyEmailTTL, link),
+	})
+
+	return nil
+}
+
+// VerifyEmail marks the email in a verification token as verified,
+// unless the user has changed their email since the link was sent
+func (ps *ProfileService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "service.VerifyEmail")
+	defer span.End()
+
+	claims, err := ps.sessionService.ValidateEmailToken(token)
+	if err != nil {
+		return err
+	}
+
+	if err := ps.storage.VerifyEmail(ctx, claims.UserId, claims.Email); err != nil {
+		// Only the owner of the mailbox gets here, so telling them the address is taken reveals nothing new
+		if storage.ViolatedConstraint(err) == storage.ConstraintEmail {
+			return Conflict("email_taken", "email is already verified by another account")
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Validation("invalid_verification_token", "verification link is invalid or expired",
+				FieldError{Field: "token", Message: "is for an address no longer on the account"})
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (ps *ProfileService) currentUser(ctx context.Context) (*models.User, error) {
+	return loadCurrentUser(ctx, ps.storage)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"kod/internal/models/config"
+	"testing"
+	"time"
+)
+
+func newProfileTestService(s *accountStorage, m *fakeMailer, cfg *config.AccountConfig) *ProfileService {
+	ss := NewSessionService(&config.SessionConfig{JwtSecret: "secret", AuthTransports: []string{TransportCookie}})
+	return NewProfileService(s, ss, m, cfg, zap.NewNop().Sugar())
+}
+
+func TestVerifyEmail(t *testing.T) {
+	s, m := newAccountStorage(testUsers()...), newFakeMailer()
+	ps := newProfileTestService(s, m, testAccountConfig())
+
+	bob := s.users[1]
+	if err := ps.SendVerification(context.Background(), &bob); err != nil {
+		t.Fatal(err)
+	}
+	msg := m.next(t)
+	if msg.To != "bob@example.com" {
+		t.Errorf("mail sent to %s, want bob@example.com", msg.To)
+	}
+
+	if err := ps.VerifyEmail(context.Background(), linkToken(t, msg, "/email/verify")); err != nil {
+		t.Fatal(err)
+	}
+	if s.users[1].EmailVerifiedAt == nil {
+		t.Error("email not verified")
+	}
+}
+
+func TestVerifyEmailRejectsExpiredLink(t *testing.T) {
+	s, m := newAccountStorage(testUsers()...), newFakeMailer()
+	cfg := testAccountConfig()
+	cfg.VerifyEmailTTL = -time.Minute
+	ps := newProfileTestService(s, m, cfg)
+
+	bob := s.users[1]
+	if err := ps.SendVerification(context.Background(), &bob); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ps.VerifyEmail(context.Background(), linkToken(t, m.next(t), "/email/verify"))
+	wantCode(t, err, "invalid_verification_token")
+	if s.users[1].EmailVerifiedAt != nil {
+		t.Error("email verified with an expired link")
+	}
+}
+
+// TestVerifyEmailRejectsReplacedAddress checks that a link sent before the email was changed can't verify the new one
+func TestVerifyEmailRejectsReplacedAddress(t *testing.T) {
+	s, m := newAccountStorage(testUsers()...), newFakeMailer()
+	ps := newProfileTestService(s, m, testAccountConfig())
+
+	bob := s.users[1]
+	if err := ps.SendVerification(context.Background(), &bob); err != nil {
+		t.Fatal(err)
+	}
+	token := linkToken(t, m.next(t), "/email/verify")
+
+	email := "bob@example.org"
+	s.users[1].Email = &email
+
+	err := ps.VerifyEmail(context.Background(), token)
+	wantCode(t, err, "invalid_verification_token")
+	if s.users[1].EmailVerifiedAt != nil {
+		t.Error("new email verified with the link of the old one")
+	}
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -9,10 +11,42 @@ import (
 	"kod/internal/models"
 	"kod/internal/models/config"
 	"net/http"
+	"strings"
 	"time"
 )
 
-const nameOfUserStruct = "user"
+const (
+	nameOfUserStruct = "user"
+	nameOfAuthMethod = "auth_method"
+)
+
+// How the request was authenticated
+const (
+	AuthSession  = "session"
+	AuthBearer   = "bearer"
+	AuthApiToken = "api_token"
+)
+
+// How a session jwt travels between the client and the server
+const (
+	TransportCookie = "cookie"
+	TransportBearer = "bearer"
+)
+
+// Session is a freshly issued session jwt, either wrapped in a cookie or handed out as is.
+// A cookie session comes with the CSRF cookie for it.
+type Session struct {
+	Cookie     *http.Cookie
+	CsrfCookie *http.Cookie
+	Token      *models.AccessToken
+}
+
+// The CSRF token is read by the client from CsrfCookieName, or from the CsrfHeader response header
+// when the client runs on another origin and can't read the cookie, and is echoed in CsrfHeader
+const (
+	CsrfCookieName = "csrf_token"
+	CsrfHeader     = "X-CSRF-Token"
+)
 
 type SessionService struct {
 	cfg *config.SessionConfig
@@ -22,10 +56,15 @@ func NewSessionService(c *config.SessionConfig) *SessionService {
 	return &SessionService{cfg: c}
 }
 
+const purposeSession = "session"
+
 func (s *SessionService) CreateToken(user *models.User) (string, error) {
 	claims := models.Claims{
-		UserId:   user.Id,
-		UserName: user.Username,
+		UserId:         user.Id,
+		UserName:       user.Username,
+		Role:           user.Role,
+		SessionVersion: user.SessionVersion,
+		Purpose:        purposeSession,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cfg.JwtTTL)),
 		},
@@ -41,28 +80,138 @@ func (s *SessionService) CreateToken(user *models.User) (string, error) {
 	return tokenString, nil
 }
 
+// AllowsTransport reports whether session jwt may be sent via transport
+func (s *SessionService) AllowsTransport(transport string) bool {
+	for _, t := range s.cfg.AuthTransports {
+		if t == transport {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSession creates a jwt token for user and packs it for transport
+func (s *SessionService) NewSession(user *models.User, transport string) (*Session, error) {
+	if !s.AllowsTransport(transport) {
+		return nil, Validation("transport_disabled", fmt.Sprintf("%s sessions are disabled", transport))
+	}
+
+	token, err := s.CreateToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if transport == TransportBearer {
+		return &Session{Token: &models.AccessToken{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(s.cfg.JwtTTL.Seconds()),
+		}}, nil
+	}
+
+	cookie, err := s.CreateCookie(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Cookie: cookie, CsrfCookie: s.csrfCookie(s.csrfToken(token), cookie.Expires)}, nil
+}
+
+// EndSession expires the session and CSRF cookies
+func (s *SessionService) EndSession() (*Session, error) {
+	cookie, err := s.DeleteCookie()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Cookie: cookie, CsrfCookie: s.csrfCookie("", time.Unix(0, 0))}, nil
+}
+
+// csrfToken derives the CSRF token from the session jwt, so it is rotated with the session
+// and can't be planted by someone who doesn't know the secret
+func (s *SessionService) csrfToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.JwtSecret))
+	mac.Write([]byte("csrf:" + sessionToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfCookie is readable by scripts, unlike the session cookie
+func (s *SessionService) csrfCookie(token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     CsrfCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// CsrfToken returns the CSRF token of the session cookie the request carries
+func (s *SessionService) CsrfToken(r *http.Request) (string, error) {
+	sessionToken, err := s.GetCookieValue(r)
+	if err != nil {
+		return "", err
+	}
+	return s.csrfToken(sessionToken), nil
+}
+
+// CheckCsrf verifies that a request carrying the session cookie echoes its CSRF token in CsrfHeader
+func (s *SessionService) CheckCsrf(r *http.Request) error {
+	if _, err := r.Cookie(s.cfg.CookieName); err != nil {
+		return nil
+	}
+
+	sessionToken, err := s.GetCookieValue(r)
+	if err != nil {
+		return err
+	}
+
+	got := r.Header.Get(CsrfHeader)
+	if got == "" {
+		return Forbidden("csrf_missing", fmt.Sprintf("%s header is required", CsrfHeader))
+	}
+	if !hmac.Equal([]byte(got), []byte(s.csrfToken(sessionToken))) {
+		return Forbidden("csrf_invalid", "CSRF token doesn't match the session")
+	}
+
+	return nil
+}
+
+// TrustedOrigin reports whether origin ("scheme://host[:port]") may make cookie authenticated requests
+func (s *SessionService) TrustedOrigin(origin string) bool {
+	for _, o := range s.cfg.TrustedOrigins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *SessionService) ValidateToken(tokenString string) (*models.Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(s.cfg.JwtSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}))
 	if err != nil {
 		switch {
 		case errors.Is(err, jwt.ErrTokenMalformed):
-			return nil, errors.New("that's not even a token")
+			return nil, Unauthorized("token_malformed", "that's not even a token")
 		case errors.Is(err, jwt.ErrTokenSignatureInvalid):
-			return nil, errors.New("invalid signature")
+			return nil, Unauthorized("token_invalid", "invalid signature")
 		case errors.Is(err, jwt.ErrTokenExpired):
-			return nil, errors.New("token is expired")
+			return nil, Unauthorized("token_expired", "token is expired")
 		case !token.Valid:
-			return nil, errors.New("invalid token")
+			return nil, Unauthorized("token_invalid", "invalid token")
 		default:
-			return nil, fmt.Errorf("couldn't handle this token: %v", err)
+			return nil, Unauthorized("token_invalid", fmt.Sprintf("couldn't handle this token: %v", err))
 		}
 	}
 
 	claims, ok := token.Claims.(*models.Claims)
 	if !ok {
-		return nil, errors.New("couldn't parse claims")
+		return nil, Unauthorized("token_invalid", "couldn't parse claims")
+	}
+	// Email, two-factor and login state tokens share the secret but must never open a session
+	if claims.Purpose != purposeSession {
+		return nil, Unauthorized("token_invalid", "not a session token")
 	}
 
 	return claims, nil
@@ -93,14 +242,14 @@ func (s *SessionService) GetCookieValue(r *http.Request) (string, error) {
 	cookie, err := r.Cookie(s.cfg.CookieName)
 	if err != nil {
 		if errors.Is(err, http.ErrNoCookie) {
-			return "", errors.New("cookie expired")
+			return "", Unauthorized("session_missing", "cookie expired")
 		}
-		return "", errors.New("server error")
+		return "", &Error{Kind: ErrUnauthorized, Code: "session_invalid", Message: "invalid cookie", Err: err}
 	}
 
 	value, err := base64.URLEncoding.DecodeString(cookie.Value)
 	if err != nil {
-		return "", errors.New("invalid cookie value")
+		return "", Unauthorized("session_invalid", "invalid cookie value")
 	}
 
 	return string(value), nil
@@ -122,7 +271,7 @@ func (s *SessionService) DeleteCookie() (*http.Cookie, error) {
 func GetUserFromContext(ctx context.Context) (*models.User, error) {
 	user, ok := ctx.Value(nameOfUserStruct).(*models.User)
 	if !ok {
-		return nil, errors.New("there is no user in context")
+		return nil, Unauthorized("session_missing", "there is no user in context")
 	}
 	return user, nil
 }
@@ -130,4 +279,136 @@ func GetUserFromContext(ctx context.Context) (*models.User, error) {
 func SetUserContext(r *http.Request, userCtx *models.User) *http.Request {
 	ctx := context.WithValue(r.Context(), nameOfUserStruct, userCtx)
 	return r.WithContext(ctx)
-}
\ No newline at end of file
+}
+
+// SessionTransport is the transport a session authenticated request came by,
+// new jwt for that session are issued the same way
+func SessionTransport(ctx context.Context) string {
+	if GetAuthMethodFromContext(ctx) == AuthBearer {
+		return TransportBearer
+	}
+	return TransportCookie
+}
+
+func GetAuthMethodFromContext(ctx context.Context) string {
+	method, _ := ctx.Value(nameOfAuthMethod).(string)
+	return method
+}
+
+func SetAuthMethodContext(r *http.Request, method string) *http.Request {
+	ctx := context.WithValue(r.Context(), nameOfAuthMethod, method)
+	return r.WithContext(ctx)
+}
+
+const purposeVerifyEmail = "verify_email"
+
+// CreateEmailToken signs a link token proving control over email, valid for ttl
+func (s *SessionService) CreateEmailToken(userId int, email string, ttl time.Duration) (string, error) {
+	claims := models.EmailClaims{
+		UserId:  userId,
+		Email:   email,
+		Purpose: purposeVerifyEmail,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+
+	return token.SignedString([]byte(s.cfg.JwtSecret))
+}
+
+func (s *SessionService) ValidateEmailToken(tokenString string) (*models.EmailClaims, error) {
+	invalid := Validation("invalid_verification_token", "verification link is invalid or expired",
+		FieldError{Field: "token", Message: "is invalid or expired"})
+
+	token, err := jwt.ParseWithClaims(tokenString, &models.EmailClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.cfg.JwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, invalid
+	}
+
+	claims, ok := token.Claims.(*models.EmailClaims)
+	if !ok || claims.Purpose != purposeVerifyEmail {
+		return nil, invalid
+	}
+
+	return claims, nil
+}
+
+const purposeMfa = "mfa"
+
+// CreateMfaToken signs a short-lived challenge proving the password step of user's login succeeded.
+// challengeId ties the token to the challenge stored for the user.
+func (s *SessionService) CreateMfaToken(user *models.User, challengeId string) (string, error) {
+	claims := models.MfaClaims{
+		UserId:         user.Id,
+		SessionVersion: user.SessionVersion,
+		Purpose:        purposeMfa,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        challengeId,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.cfg.MfaTokenTTL)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+
+	return token.SignedString([]byte(s.cfg.JwtSecret))
+}
+
+func (s *SessionService) ValidateMfaToken(tokenString string) (*models.MfaClaims, error) {
+	invalid := Unauthorized("mfa_token_invalid", "two-factor challenge is invalid or expired")
+
+	token, err := jwt.ParseWithClaims(tokenString, &models.MfaClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.cfg.JwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, invalid
+	}
+
+	claims, ok := token.Claims.(*models.MfaClaims)
+	if !ok || claims.Purpose != purposeMfa {
+		return nil, invalid
+	}
+
+	return claims, nil
+}
+
+const purposeOidcState = "oidc_state"
+
+// CreateOidcStateToken signs the state, nonce and PKCE verifier of a login started with provider
+func (s *SessionService) CreateOidcStateToken(provider, state, nonce, verifier string, ttl time.Duration) (string, error) {
+	claims := models.OidcStateClaims{
+		Provider: provider,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Purpose:  purposeOidcState,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+
+	return token.SignedString([]byte(s.cfg.JwtSecret))
+}
+
+func (s *SessionService) ValidateOidcStateToken(tokenString string) (*models.OidcStateClaims, error) {
+	invalid := Unauthorized("oidc_state_invalid", "login state is invalid or expired, start the login again")
+
+	token, err := jwt.ParseWithClaims(tokenString, &models.OidcStateClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.cfg.JwtSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, invalid
+	}
+
+	claims, ok := token.Claims.(*models.OidcStateClaims)
+	if !ok || claims.Purpose != purposeOidcState {
+		return nil, invalid
+	}
+
+	return claims, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/text/unicode/norm"
 	"kod/internal/models"
 	"kod/internal/storage"
 	"net/http"
@@ -15,56 +16,281 @@ import (
 type UserService struct {
 	storage        storage.Storage
 	sessionService *SessionService
+	mfaService     *MfaService
 }
 
-func NewUserService(s storage.Storage, ss *SessionService) *UserService {
-	return &UserService{storage: s, sessionService: ss}
+func NewUserService(s storage.Storage, ss *SessionService, ms *MfaService) *UserService {
+	return &UserService{storage: s, sessionService: ss, mfaService: ms}
 }
 
-// SignUp Hashes password and adds user to db
-func (us *UserService) SignUp(ctx context.Context, user *models.User) (*models.User, error) {
-	_, err := us.storage.GetUser(ctx, user.Username)
-	if err == nil {
-		return nil, errors.New(fmt.Sprintf("user already exists: %s", user.Username))
+// NormalizeUsername folds compatibility characters (NFKC) and case,
+// so "Alice", "ALICE" and fullwidth "Ａｌｉｃｅ" name the same user
+func NormalizeUsername(username string) string {
+	return strings.ToLower(norm.NFKC.String(strings.TrimSpace(username)))
+}
+
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// SignUp Hashes password and adds user to db.
+// Uniqueness is enforced by the database, so concurrent signups can't both succeed.
+func (us *UserService) SignUp(ctx context.Context, req *models.SignUpRequest) (*models.User, error) {
+	req.Username = NormalizeUsername(req.Username)
+	if err := validateStruct(req); err != nil {
+		return nil, err
+	}
+	if req.Login && !us.sessionService.AllowsTransport(TransportCookie) {
+		return nil, Validation("transport_disabled", "cookie sessions are disabled, log in for a token")
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
-	user.Username = strings.ToLower(user.Username)
-	user.Password = string(hash)
+	user := &models.User{
+		Username: req.Username,
+		Password: string(hash),
+	}
+	if req.Email != "" {
+		email := NormalizeEmail(req.Email)
+		user.Email = &email
+	}
 
 	newUser, err := us.storage.AddUser(ctx, user)
 	if err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			return nil, Conflict("user_exists", fmt.Sprintf("user already exists: %s", req.Username))
+		}
 		return nil, err
 	}
 
 	return &newUser, nil
 }
 
-// LogIn Validates user's password, creates a jwt token and cookie
-func (us *UserService) LogIn(r *http.Request, userRequest *models.User) (*http.Cookie, error) {
-	user, err := us.storage.GetUser(r.Context(), userRequest.Username)
+// NewSession creates a jwt token for user, in a session cookie or as a bearer token
+func (us *UserService) NewSession(user *models.User, transport string) (*Session, error) {
+	return us.sessionService.NewSession(user, transport)
+}
+
+// loginTransport picks the transport asked for by a login request
+func loginTransport(returnToken bool) string {
+	if returnToken {
+		return TransportBearer
+	}
+	return TransportCookie
+}
+
+// LogIn Validates user's password, creates a jwt token and session.
+// Users with two-factor authentication get a challenge instead of the session.
+func (us *UserService) LogIn(r *http.Request, userRequest *models.LogInRequest) (*Session, *models.LogInChallenge, error) {
+	if userRequest.Username == "" || userRequest.Password == "" {
+		return nil, nil, Validation("invalid_input", "username and password are required")
+	}
+
+	user, err := us.storage.GetUser(r.Context(), NormalizeUsername(userRequest.Username))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, errors.New("user not found")
+			return nil, nil, Unauthorized("invalid_credentials", "invalid username or password")
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(userRequest.Password)); err != nil {
-		return nil, errors.New("invalid password")
+		return nil, nil, Unauthorized("invalid_credentials", "invalid username or password")
+	}
+	if user.DisabledAt != nil {
+		return nil, nil, Unauthorized("account_disabled", "account is disabled")
+	}
+
+	transport := loginTransport(userRequest.ReturnToken)
+	if !us.sessionService.AllowsTransport(transport) {
+		return nil, nil, Validation("transport_disabled", fmt.Sprintf("%s sessions are disabled", transport))
+	}
+
+	if user.TotpEnabled {
+		challenge, err := newMfaChallenge(r.Context(), us.storage, us.sessionService, &user)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, challenge, nil
+	}
+
+	session, err := us.NewSession(&user, transport)
+	return session, nil, err
+}
+
+// LogInMfa completes a login challenged for the second factor.
+// A challenge is answered once and voided after mfaAttempts wrong codes.
+func (us *UserService) LogInMfa(ctx context.Context, req *models.MfaLogInRequest) (*Session, error) {
+	if err := validateStruct(req); err != nil {
+		return nil, err
+	}
+
+	claims, err := us.sessionService.ValidateMfaToken(req.MfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := us.storage.GetUserById(ctx, claims.UserId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, Unauthorized("mfa_token_invalid", "two-factor challenge is invalid or expired")
+		}
+		return nil, err
+	}
+	// A password change since the first step voids the challenge
+	if user.SessionVersion != claims.SessionVersion || !user.TotpEnabled || user.DisabledAt != nil {
+		return nil, Unauthorized("mfa_token_invalid", "two-factor challenge is invalid or expired")
+	}
+
+	if err := us.storage.UseMfaAttempt(ctx, user.Id, claims.ID, mfaAttempts); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, Unauthorized("mfa_token_invalid", "two-factor challenge is invalid or expired, log in again")
+		}
+		return nil, err
+	}
+	if err := us.mfaService.VerifySecondFactor(ctx, &user, req.Code, req.RecoveryCode); err != nil {
+		return nil, err
+	}
+	if err := us.storage.EndMfaChallenge(ctx, user.Id, claims.ID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, Unauthorized("mfa_token_invalid", "two-factor challenge is invalid or expired")
+		}
+		return nil, err
+	}
+
+	return us.NewSession(&user, loginTransport(req.ReturnToken))
+}
+
+func (us *UserService) LogOut() (*Session, error) {
+	return us.sessionService.EndSession()
+}
+
+// Authenticate checks that the token's session hasn't been revoked and the account is enabled.
+// It returns the current user, whose role is read from db rather than trusted from the token.
+func (us *UserService) Authenticate(ctx context.Context, claims *models.Claims) (*models.User, error) {
+	user, err := us.storage.GetUserById(ctx, claims.UserId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, Unauthorized("session_revoked", "user no longer exists")
+		}
+		return nil, err
+	}
+
+	if user.SessionVersion != claims.SessionVersion {
+		return nil, Unauthorized("session_revoked", "session has been revoked")
+	}
+	if user.DisabledAt != nil {
+		return nil, Unauthorized("account_disabled", "account is disabled")
+	}
+
+	return &user, nil
+}
+
+// ChangePassword verifies the current password, stores the new hash and revokes all other sessions.
+// It returns a fresh session for the one that made the change.
+func (us *UserService) ChangePassword(ctx context.Context, req *models.ChangePasswordRequest) (*Session, error) {
+	if err := validateStruct(req); err != nil {
+		return nil, err
+	}
+
+	user, err := us.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return nil, Validation("invalid_password", "current password is incorrect",
+			FieldError{Field: "current_password", Message: "is incorrect"})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := us.storage.UpdatePassword(ctx, user.Id, string(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	return us.NewSession(&updated, SessionTransport(ctx))
+}
+
+// DeleteAccount removes the current user and their notes once the password and username confirmation match.
+// With export set, the user's data is collected before deletion and returned.
+func (us *UserService) DeleteAccount(ctx context.Context, req *models.DeleteAccountRequest, export bool) (*models.AccountExport, error) {
+	if err := validateStruct(req); err != nil {
+		return nil, err
 	}
 
-	token, err := us.sessionService.CreateToken(&user)
+	user, err := us.currentUser(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return us.sessionService.CreateCookie(token)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return nil, Validation("invalid_password", "password is incorrect",
+			FieldError{Field: "password", Message: "is incorrect"})
+	}
+	if NormalizeUsername(req.Confirm) != user.Username {
+		return nil, Validation("confirmation_required", "account deletion is not confirmed",
+			FieldError{Field: "confirm", Message: "must repeat your username"})
+	}
+
+	var data *models.AccountExport
+	if export {
+		data, err = us.exportAccount(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := us.storage.DeleteUser(ctx, user.Id); err != nil {
+		return nil, err
+	}
+
+	return data, nil
 }
 
-func (us *UserService) LogOut() (*http.Cookie, error) {
-	return us.sessionService.DeleteCookie()
-}
\ No newline at end of file
+func (us *UserService) exportAccount(ctx context.Context, user *models.User) (*models.AccountExport, error) {
+	const pageSize = 100
+
+	data := &models.AccountExport{
+		User:  models.NewUserResponse(user),
+		Notes: []models.Note{},
+	}
+	for offset := 0; ; offset += pageSize {
+		notes, err := us.storage.GetNotes(ctx, user.Id, offset, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		data.Notes = append(data.Notes, notes...)
+		if len(notes) < pageSize {
+			return data, nil
+		}
+	}
+}
+
+func (us *UserService) currentUser(ctx context.Context) (*models.User, error) {
+	return loadCurrentUser(ctx, us.storage)
+}
+
+// loadCurrentUser loads the authenticated user, including the password hash
+func loadCurrentUser(ctx context.Context, s storage.UserStorage) (*models.User, error) {
+	ctxUser, err := GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUserById(ctx, ctxUser.Id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, NotFound("user_not_found", "user not found")
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"kod/internal/lang"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything after 72 bytes
+	maxPasswordLength = 72
+)
+
+// validate applies the `validate` struct tags declared on models
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || name == "" {
+			return f.Name
+		}
+		return name
+	})
+	_ = v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return validUsername(fl.Field().String())
+	})
+	_ = v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		return validPassword(fl.Field().String())
+	})
+	_ = v.RegisterValidation("timezone", func(fl validator.FieldLevel) bool {
+		_, err := time.LoadLocation(fl.Field().String())
+		return err == nil
+	})
+	_ = v.RegisterValidation("lang", func(fl validator.FieldLevel) bool {
+		l := fl.Field().String()
+		return l == "" || lang.IsSupported(l)
+	})
+	_ = v.RegisterValidation("word", func(fl validator.FieldLevel) bool {
+		return validWord(fl.Field().String())
+	})
+	_ = v.RegisterValidation("utf8", func(fl validator.FieldLevel) bool {
+		return validUTF8(fl.Field().String())
+	})
+	return v
+}
+
+// validateStruct checks v against its rules and returns all violations in one validation error
+func validateStruct(v any) error {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{Field: fe.Field(), Message: ruleMessage(fe)})
+	}
+	return Validation("invalid_input", "request contains invalid fields", fields...)
+}
+
+func ruleMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "either this or the alternative field is required"
+	case "numeric":
+		return "must contain only digits"
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters long", fe.Param())
+	case "min":
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "username":
+		return "may contain only letters, digits, '.', '_' and '-' and must start with a letter or digit"
+	case "password":
+		return fmt.Sprintf("must be %d to %d bytes long and contain at least one letter and one digit", minPasswordLength, maxPasswordLength)
+	case "email":
+		return "must be a valid email address"
+	case "timezone":
+		return "must be an IANA time zone name, e.g. Europe/Moscow"
+	case "lang":
+		return "must be one of ru, en, uk or empty to detect the language"
+	case "word":
+		return "must be a single word of letters and digits, inner apostrophes and hyphens are allowed"
+	case "utf8":
+		return "must be valid UTF-8 text"
+	default:
+		return fmt.Sprintf("failed %q rule", fe.Tag())
+	}
+}
+
+func validUsername(s string) bool {
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+		case i > 0 && (r == '.' || r == '_' || r == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validWord(s string) bool {
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r), unicode.IsMark(r), unicode.IsDigit(r):
+		case i > 0 && i < len(runes)-1 && (r == '\'' || r == '’' || r == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validPassword(s string) bool {
+	if len(s) < minPasswordLength || len(s) > maxPasswordLength {
+		return false
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLetter && hasDigit
+}
+
+// validUTF8 also rejects U+FFFD, which encoding/json substitutes for invalid input bytes
+func validUTF8(s string) bool {
+	return utf8.ValidString(s) && !strings.ContainsRune(s, utf8.RuneError)
+}
@@ -0,0 +1,85 @@
+package speller
+
+import (
+	"context"
+	"errors"
+	"kod/internal/models/config"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCancelledProbeReleasesBreaker checks that a half-open probe abandoned by its caller
+// lets the next call probe again instead of leaving the circuit open for good
+func TestCancelledProbeReleasesBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	started := make(chan struct{}, 1)
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if healthy.Load() {
+			_, _ = w.Write([]byte(`[[]]`))
+			return
+		}
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	c := NewClient(&config.SpellerConfig{
+		URL:              server.URL,
+		ConnectTimeout:   time.Second,
+		Timeout:          5 * time.Second,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Millisecond,
+	})
+
+	// Open the circuit and wait out the cooldown
+	c.breaker.failure()
+	time.Sleep(2 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := c.CheckTexts(ctx, "", []string{"text"}); !errors.Is(err, ErrUnavailable) || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("probe: got %v, want a cancelled call", err)
+	}
+
+	healthy.Store(true)
+	if _, err := c.CheckTexts(context.Background(), "", []string{"text"}); err != nil {
+		t.Fatalf("call after a cancelled probe: %v", err)
+	}
+	if !c.breaker.allow() {
+		t.Error("circuit isn't closed after a successful probe")
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	b := newBreaker(1, time.Millisecond)
+	b.failure()
+	if b.allow() {
+		t.Fatal("open circuit allowed a call")
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("circuit didn't let a probe through after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("circuit let a second probe through")
+	}
+	b.release()
+	if !b.allow() {
+		t.Fatal("released probe wasn't replaced")
+	}
+}
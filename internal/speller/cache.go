@@ -0,0 +1,107 @@
+package speller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"kod/internal/cache"
+	"kod/internal/models/config"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "kod_speller_cache_requests_total",
+	Help: "Spell-check cache lookups by result.",
+}, []string{"result"})
+
+// CachedClient is a Checker that remembers the results of a Client.
+// With paragraphs enabled texts are checked line by line, so editing one line of a note
+// only sends that line to the speller.
+type CachedClient struct {
+	client     Checker
+	entries    *cache.LRU[string, []Mistake]
+	options    string
+	paragraphs bool
+}
+
+func NewCachedClient(c *Client, cfg *config.SpellerConfig) *CachedClient {
+	return &CachedClient{
+		client:     c,
+		entries:    cache.NewLRU[string, []Mistake](cfg.CacheSize, cfg.CacheTTL),
+		options:    strconv.Itoa(c.options()),
+		paragraphs: cfg.CacheParagraphs,
+	}
+}
+
+// CheckTexts answers from the cache and checks the rest in one batch
+func (c *CachedClient) CheckTexts(ctx context.Context, lang string, texts []string) ([][]Mistake, error) {
+	span := trace.SpanFromContext(ctx)
+
+	units := make([][]string, len(texts))
+	results := make(map[string][]Mistake)
+	var missed []string
+	for i, text := range texts {
+		units[i] = []string{text}
+		if c.paragraphs {
+			units[i] = strings.Split(text, "\n")
+		}
+
+		for _, unit := range units[i] {
+			if strings.TrimSpace(unit) == "" {
+				continue
+			}
+			key := c.key(lang, unit)
+			if _, ok := results[key]; ok {
+				continue
+			}
+			if mistakes, ok := c.entries.Get(key); ok {
+				cacheRequests.WithLabelValues("hit").Inc()
+				results[key] = mistakes
+				continue
+			}
+			cacheRequests.WithLabelValues("miss").Inc()
+			results[key] = nil
+			missed = append(missed, unit)
+		}
+	}
+	span.SetAttributes(attribute.Int("speller.cache_misses", len(missed)))
+
+	if len(missed) > 0 {
+		checked, err := c.client.CheckTexts(ctx, lang, missed)
+		if err != nil {
+			return nil, err
+		}
+		for i, unit := range missed {
+			key := c.key(lang, unit)
+			c.entries.Add(key, checked[i])
+			results[key] = checked[i]
+		}
+	}
+
+	mistakes := make([][]Mistake, len(texts))
+	for i := range texts {
+		pos := 0
+		for row, unit := range units[i] {
+			for _, m := range results[c.key(lang, unit)] {
+				m.Pos += pos
+				m.Row += row
+				mistakes[i] = append(mistakes[i], m)
+			}
+			pos += utf8.RuneCountInString(unit) + 1
+		}
+	}
+
+	return mistakes, nil
+}
+
+// key identifies a text checked in lang with the client's options
+func (c *CachedClient) key(lang, text string) string {
+	sum := sha256.Sum256([]byte(c.options + "\x00" + lang + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package speller
+
+import (
+	"context"
+	"kod/internal/cache"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeChecker finds the word "bad" in every text and records the batches it was asked to check
+type fakeChecker struct {
+	batches [][]string
+}
+
+func (f *fakeChecker) CheckTexts(ctx context.Context, lang string, texts []string) ([][]Mistake, error) {
+	f.batches = append(f.batches, texts)
+	mistakes := make([][]Mistake, len(texts))
+	for i, text := range texts {
+		if pos := strings.Index(text, "bad"); pos >= 0 {
+			mistakes[i] = []Mistake{{Pos: len([]rune(text[:pos])), Len: 3, Word: "bad"}}
+		}
+	}
+	return mistakes, nil
+}
+
+func newTestCachedClient(paragraphs bool) (*CachedClient, *fakeChecker) {
+	f := &fakeChecker{}
+	return &CachedClient{
+		client:     f,
+		entries:    cache.NewLRU[string, []Mistake](100, time.Minute),
+		options:    "0",
+		paragraphs: paragraphs,
+	}, f
+}
+
+func TestCachedClientKeysByLang(t *testing.T) {
+	c, f := newTestCachedClient(false)
+
+	for _, lang := range []string{"ru", "en", "ru", ""} {
+		if _, err := c.CheckTexts(context.Background(), lang, []string{"bad text"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(f.batches) != 3 {
+		t.Errorf("speller called %d times, want 3: once for ru, en and no lang", len(f.batches))
+	}
+}
+
+// TestCachedClientParagraphOffsets checks that mistakes of a cached line and of a checked one
+// are placed within the whole text
+func TestCachedClientParagraphOffsets(t *testing.T) {
+	c, f := newTestCachedClient(true)
+
+	if _, err := c.CheckTexts(context.Background(), "", []string{"a bad line"}); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "первая строка\na bad line\nnew bad one"
+	mistakes, err := c.CheckTexts(context.Background(), "", []string{text})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.batches) != 2 || len(f.batches[1]) != 2 {
+		t.Fatalf("batches = %q, want the cached line left out of the second", f.batches)
+	}
+	want := []Mistake{
+		{Pos: 16, Row: 1, Len: 3, Word: "bad"},
+		{Pos: 29, Row: 2, Len: 3, Word: "bad"},
+	}
+	if len(mistakes[0]) != len(want) {
+		t.Fatalf("mistakes = %+v, want %+v", mistakes[0], want)
+	}
+	runes := []rune(text)
+	for i, m := range mistakes[0] {
+		if m.Pos != want[i].Pos || m.Row != want[i].Row {
+			t.Errorf("mistake %d at pos %d row %d, want pos %d row %d", i, m.Pos, m.Row, want[i].Pos, want[i].Row)
+		}
+		if got := string(runes[m.Pos : m.Pos+m.Len]); got != m.Word {
+			t.Errorf("mistake %d points at %q, want %q", i, got, m.Word)
+		}
+	}
+}
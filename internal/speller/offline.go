@@ -0,0 +1,122 @@
+package speller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
+	"kod/internal/lang"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Mistake codes, the same the Yandex Speller uses
+const (
+	CodeUnknownWord = 1
+	CodeRepeatWord  = 2
+)
+
+// ErrDegraded comes with mistakes found by the fallback checker instead of the speller.
+// They are a best effort, the texts should be checked again once the speller is back.
+var ErrDegraded = errors.New("speller unavailable, checked offline")
+
+var fallbackChecks = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "kod_speller_fallback_checks_total",
+	Help: "Checks answered by the offline checker while the speller was unavailable.",
+})
+
+// homoglyphs maps Latin letters to the Cyrillic letters that look the same
+var homoglyphs = map[rune]rune{
+	'a': 'а', 'c': 'с', 'e': 'е', 'o': 'о', 'p': 'р', 'x': 'х', 'y': 'у', 'k': 'к',
+	'A': 'А', 'B': 'В', 'C': 'С', 'E': 'Е', 'H': 'Н', 'K': 'К', 'M': 'М', 'O': 'О', 'P': 'Р', 'T': 'Т', 'X': 'Х',
+}
+
+// Offline is a Checker that needs no network. It has no dictionary and only catches
+// what can be told from the letters: repeated words, words mixing Latin and Cyrillic letters
+// and letters that don't belong to the language of the text.
+type Offline struct{}
+
+func NewOffline() *Offline {
+	return &Offline{}
+}
+
+func (o *Offline) CheckTexts(_ context.Context, l string, texts []string) ([][]Mistake, error) {
+	mistakes := make([][]Mistake, len(texts))
+	for i, text := range texts {
+		mistakes[i] = o.check(l, text)
+	}
+	return mistakes, nil
+}
+
+func (o *Offline) check(l, text string) []Mistake {
+	if l == "" {
+		l = lang.Detect(text)
+	}
+	foreign := lang.ForeignLetters(l)
+
+	var mistakes []Mistake
+	var previous string
+	for _, word := range lang.Words(text) {
+		w := Mistake{Pos: word.Pos, Row: word.Row, Col: word.Col, Len: word.Len, Word: word.Text}
+		switch {
+		case strings.EqualFold(w.Word, previous):
+			w.Code = CodeRepeatWord
+		case mixedScript(w.Word):
+			w.Code = CodeUnknownWord
+			if fixed := toCyrillic(w.Word); !mixedScript(fixed) {
+				w.Suggestions = []string{fixed}
+			}
+		case strings.ContainsFunc(w.Word, func(r rune) bool { return slices.Contains(foreign, unicode.ToLower(r)) }):
+			w.Code = CodeUnknownWord
+		}
+		previous = w.Word
+		if w.Code != 0 {
+			mistakes = append(mistakes, w)
+		}
+	}
+
+	return mistakes
+}
+
+func mixedScript(word string) bool {
+	return strings.ContainsFunc(word, func(r rune) bool { return unicode.Is(unicode.Latin, r) }) &&
+		strings.ContainsFunc(word, func(r rune) bool { return unicode.Is(unicode.Cyrillic, r) })
+}
+
+func toCyrillic(word string) string {
+	return strings.Map(func(r rune) rune {
+		if c, ok := homoglyphs[r]; ok {
+			return c
+		}
+		return r
+	}, word)
+}
+
+// Fallback is a Checker that turns to a secondary checker while the primary one is unavailable.
+// The secondary checker's mistakes are returned together with ErrDegraded.
+type Fallback struct {
+	primary   Checker
+	secondary Checker
+}
+
+func NewFallback(primary, secondary Checker) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary}
+}
+
+func (f *Fallback) CheckTexts(ctx context.Context, lang string, texts []string) ([][]Mistake, error) {
+	mistakes, err := f.primary.CheckTexts(ctx, lang, texts)
+	if err == nil || !errors.Is(err, ErrUnavailable) || ctx.Err() != nil {
+		return mistakes, err
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("speller.fallback")
+	fallbackChecks.Inc()
+	mistakes, secondaryErr := f.secondary.CheckTexts(ctx, lang, texts)
+	if secondaryErr != nil {
+		return nil, secondaryErr
+	}
+	return mistakes, fmt.Errorf("%w: %v", ErrDegraded, err)
+}
@@ -0,0 +1,93 @@
+package speller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestOfflineCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		lang string
+		text string
+		want []Mistake
+	}{
+		{"clean", "", "Обычный текст без ошибок", nil},
+		{"repeated word", "", "это это текст", []Mistake{{Code: CodeRepeatWord, Pos: 4, Col: 4, Len: 3, Word: "это"}}},
+		{"mixed script", "ru", "мoлоко", []Mistake{{Code: CodeUnknownWord, Len: 6, Word: "мoлоко", Suggestions: []string{"молоко"}}}},
+		{"ukrainian letter in russian", "ru", "мир і дом", []Mistake{{Code: CodeUnknownWord, Pos: 4, Col: 4, Len: 1, Word: "і"}}},
+		{"russian letter in ukrainian", "uk", "Привіт, ёжик", []Mistake{{Code: CodeUnknownWord, Pos: 8, Col: 8, Len: 4, Word: "ёжик"}}},
+		{"english is only checked for repeats", "en", "the the cat", []Mistake{{Code: CodeRepeatWord, Pos: 4, Col: 4, Len: 3, Word: "the"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewOffline().check(tt.lang, tt.text)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("check(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// stubChecker answers every check with its mistakes and err
+type stubChecker struct {
+	mistakes [][]Mistake
+	err      error
+	calls    int
+}
+
+func (s *stubChecker) CheckTexts(context.Context, string, []string) ([][]Mistake, error) {
+	s.calls++
+	return s.mistakes, s.err
+}
+
+func TestFallback(t *testing.T) {
+	offline := [][]Mistake{{{Code: CodeRepeatWord, Word: "это"}}}
+	online := [][]Mistake{{{Code: CodeUnknownWord, Word: "ошибка"}}}
+	other := errors.New("bad request")
+
+	tests := []struct {
+		name         string
+		primary      *stubChecker
+		wantErr      error
+		wantMistakes [][]Mistake
+		wantOffline  bool
+	}{
+		{"speller answers", &stubChecker{mistakes: online}, nil, online, false},
+		{"speller unavailable", &stubChecker{err: fmt.Errorf("%w: timeout", ErrUnavailable)}, ErrDegraded, offline, true},
+		{"circuit open", &stubChecker{err: ErrCircuitOpen}, ErrDegraded, offline, true},
+		{"other error", &stubChecker{err: other}, other, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secondary := &stubChecker{mistakes: offline}
+			mistakes, err := NewFallback(tt.primary, secondary).CheckTexts(context.Background(), "ru", []string{"text"})
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrDegraded) && errors.Is(err, ErrUnavailable) {
+				t.Errorf("degraded result reported as unavailable: %v", err)
+			}
+			if fmt.Sprint(mistakes) != fmt.Sprint(tt.wantMistakes) {
+				t.Errorf("mistakes = %+v, want %+v", mistakes, tt.wantMistakes)
+			}
+			if (secondary.calls > 0) != tt.wantOffline {
+				t.Errorf("offline checker called %d times", secondary.calls)
+			}
+		})
+	}
+}
+
+func TestFallbackLeavesCancelledChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	secondary := &stubChecker{}
+	_, err := NewFallback(&stubChecker{err: fmt.Errorf("%w: %w", ErrUnavailable, context.Canceled)}, secondary).CheckTexts(ctx, "", []string{"text"})
+	if !errors.Is(err, ErrUnavailable) || secondary.calls != 0 {
+		t.Errorf("err = %v and %d offline checks, want the speller's error and none", err, secondary.calls)
+	}
+}
@@ -0,0 +1,208 @@
+// Package speller is a client of the Yandex Speller API
+package speller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"io"
+	"kod/internal/models/config"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var tracer = otel.Tracer("kod/internal/speller")
+
+// ErrUnavailable is returned when the speller couldn't check the text: it is down, too slow,
+// answers with errors or the circuit is open
+var ErrUnavailable = errors.New("speller unavailable")
+
+// ErrCircuitOpen is an ErrUnavailable returned without calling the speller
+var ErrCircuitOpen = fmt.Errorf("%w: circuit open", ErrUnavailable)
+
+// Mistake is a spelling error found in the text
+type Mistake struct {
+	Code        int      `json:"code"`
+	Pos         int      `json:"pos"`
+	Row         int      `json:"row"`
+	Col         int      `json:"col"`
+	Len         int      `json:"len"`
+	Word        string   `json:"word"`
+	Suggestions []string `json:"s"`
+}
+
+// Checker finds mistakes in several texts at once.
+// The texts are checked in lang, an empty lang lets the checker guess it.
+type Checker interface {
+	CheckTexts(ctx context.Context, lang string, texts []string) ([][]Mistake, error)
+}
+
+// Client is safe for concurrent use and is meant to be shared
+type Client struct {
+	http    *http.Client
+	cfg     *config.SpellerConfig
+	breaker *breaker
+}
+
+func NewClient(cfg *config.SpellerConfig) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = cfg.ConnectTimeout
+
+	return &Client{
+		http:    &http.Client{Transport: transport},
+		cfg:     cfg,
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+}
+
+// Speller options, see https://yandex.ru/dev/speller/doc/ru/reference/speller-options
+const (
+	optionIgnoreDigits         = 2
+	optionIgnoreURLs           = 4
+	optionIgnoreCapitalization = 512
+)
+
+// CheckText returns the mistakes found in text
+func (c *Client) CheckText(ctx context.Context, lang, text string) ([]Mistake, error) {
+	mistakes, err := c.CheckTexts(ctx, lang, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return mistakes[0], nil
+}
+
+// CheckTexts checks several texts in one round-trip and returns the mistakes of each text in order.
+// Network errors, 429 and 5xx responses are retried with jittered exponential backoff
+// until the retries or the deadline run out.
+func (c *Client) CheckTexts(ctx context.Context, lang string, texts []string) ([][]Mistake, error) {
+	ctx, span := tracer.Start(ctx, "speller.CheckTexts")
+	defer span.End()
+	span.SetAttributes(attribute.Int("speller.texts", len(texts)), attribute.String("speller.lang", lang))
+
+	if !c.breaker.allow() {
+		span.RecordError(ErrCircuitOpen)
+		return nil, ErrCircuitOpen
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	form := url.Values{
+		"text":    texts,
+		"options": {strconv.Itoa(c.options())},
+		"format":  {"plain"},
+	}
+	// Without lang the speller checks Russian and English
+	if lang != "" {
+		form.Set("lang", lang)
+	}
+
+	var body []byte
+	var err error
+	for attempt := 0; ; attempt++ {
+		span.SetAttributes(attribute.Int("speller.attempts", attempt+1))
+
+		var retry bool
+		body, retry, err = c.post(ctx, "/checkTexts", form)
+		if err == nil || !retry || attempt == c.cfg.MaxRetries {
+			break
+		}
+
+		if sleepErr := sleep(ctx, c.backoff(attempt)); sleepErr != nil {
+			break
+		}
+	}
+
+	var mistakes [][]Mistake
+	if err == nil {
+		if err = json.Unmarshal(body, &mistakes); err != nil {
+			err = fmt.Errorf("failed to parse response: %w", err)
+		} else if len(mistakes) != len(texts) {
+			err = fmt.Errorf("got results for %d of %d texts", len(mistakes), len(texts))
+		}
+	}
+
+	if err != nil {
+		// A caller giving up says nothing about the speller's health
+		if errors.Is(ctx.Err(), context.Canceled) {
+			c.breaker.release()
+		} else {
+			c.breaker.failure()
+		}
+		span.RecordError(err)
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	c.breaker.success()
+
+	return mistakes, nil
+}
+
+// post makes a single request, reporting whether its failure is worth a retry
+func (c *Client) post(ctx context.Context, endpoint string, form url.Values) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.URL+endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return body, false, nil
+}
+
+func (c *Client) options() int {
+	var options int
+	if c.cfg.IgnoreDigits {
+		options |= optionIgnoreDigits
+	}
+	if c.cfg.IgnoreURLs {
+		options |= optionIgnoreURLs
+	}
+	if c.cfg.IgnoreCapitalization {
+		options |= optionIgnoreCapitalization
+	}
+	return options
+}
+
+// backoff doubles RetryBackoff with each attempt and spreads it by ±50%
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.RetryBackoff << attempt
+	return d/2 + rand.N(d+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
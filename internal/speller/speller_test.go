@@ -0,0 +1,92 @@
+package speller
+
+import (
+	"context"
+	"encoding/json"
+	"kod/internal/models/config"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestCheckTextsEncodesForm checks that texts with form metacharacters reach the speller intact
+// and that the batch results come back matched to their texts
+func TestCheckTextsEncodesForm(t *testing.T) {
+	texts := []string{
+		"Tom & Jerry = friends?",
+		"1+1 is two\nsecond line & more",
+		"a=b&c=d?e+f",
+		"простой текст",
+	}
+
+	var form map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		form = r.PostForm
+
+		// Each text gets a mistake naming it, in the order the texts were sent
+		results := make([][]Mistake, len(r.PostForm["text"]))
+		for i, text := range r.PostForm["text"] {
+			results[i] = []Mistake{{Word: text}}
+		}
+		_ = json.NewEncoder(w).Encode(results)
+	}))
+	defer server.Close()
+
+	c := NewClient(&config.SpellerConfig{
+		URL:              server.URL,
+		ConnectTimeout:   time.Second,
+		Timeout:          5 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Second,
+		IgnoreDigits:     true,
+		IgnoreURLs:       true,
+	})
+
+	mistakes, err := c.CheckTexts(context.Background(), "en", texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(form["text"], texts) {
+		t.Errorf("text = %q, want %q", form["text"], texts)
+	}
+	if want := []string{"6"}; !reflect.DeepEqual(form["options"], want) {
+		t.Errorf("options = %q, want %q", form["options"], want)
+	}
+	if want := []string{"en"}; !reflect.DeepEqual(form["lang"], want) {
+		t.Errorf("lang = %q, want %q", form["lang"], want)
+	}
+
+	if len(mistakes) != len(texts) {
+		t.Fatalf("got results for %d texts, want %d", len(mistakes), len(texts))
+	}
+	for i, text := range texts {
+		if len(mistakes[i]) != 1 || mistakes[i][0].Word != text {
+			t.Errorf("results of text %d = %+v, want the mistake of %q", i, mistakes[i], text)
+		}
+	}
+}
+
+func TestCheckTextsWithoutLang(t *testing.T) {
+	var form map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		_, _ = w.Write([]byte(`[[]]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(&config.SpellerConfig{URL: server.URL, ConnectTimeout: time.Second, Timeout: 5 * time.Second, BreakerThreshold: 5})
+	if _, err := c.CheckText(context.Background(), "", "text"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := form["lang"]; ok {
+		t.Errorf("lang = %q, want none", form["lang"])
+	}
+}
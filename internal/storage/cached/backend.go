@@ -0,0 +1,95 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"kod/internal/cache"
+	"time"
+)
+
+// Backend stores cache entries, each entry lives for the TTL the backend was created with
+type Backend interface {
+	// Get reports false for a missing entry
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// GetMany returns the entries in the order of keys, nil for missing ones
+	GetMany(ctx context.Context, keys []string) ([][]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Memory keeps entries in an LRU of this process
+type Memory struct {
+	entries *cache.LRU[string, []byte]
+}
+
+func NewMemory(size int, ttl time.Duration) *Memory {
+	return &Memory{entries: cache.NewLRU[string, []byte](size, ttl)}
+}
+
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	value, ok := m.entries.Get(key)
+	return value, ok, nil
+}
+
+func (m *Memory) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _, _ = m.Get(ctx, key)
+	}
+	return values, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte) error {
+	m.entries.Add(key, value)
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.entries.Remove(key)
+	return nil
+}
+
+// Redis keeps entries in a server speaking the Redis protocol, so instances share them
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{client: client, ttl: ttl}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (r *Redis) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	results, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, len(keys))
+	for i, result := range results {
+		if s, ok := result.(string); ok {
+			values[i] = []byte(s)
+		}
+	}
+	return values, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte) error {
+	return r.client.Set(ctx, key, value, r.ttl).Err()
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
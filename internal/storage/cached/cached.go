@@ -0,0 +1,236 @@
+// Package cached is a read-through cache in front of the storage.
+// It caches the pages of a user's notes as lists of ids and every note on its own,
+// so finishing the grammar check of a note doesn't throw away the pages it is on.
+package cached
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"kod/internal/models"
+	"kod/internal/storage"
+	"kod/internal/util"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var tracer = otel.Tracer("kod/internal/storage/cached")
+
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "kod_storage_cache_requests_total",
+	Help: "Storage cache lookups by kind and result.",
+}, []string{"kind", "result"})
+
+var hits, lookups atomic.Int64
+
+var hitRatio = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Name: "kod_storage_cache_hit_ratio",
+	Help: "Share of note page reads answered from the cache since start.",
+}, func() float64 {
+	n := lookups.Load()
+	if n == 0 {
+		return 0
+	}
+	return float64(hits.Load()) / float64(n)
+})
+
+// Storage caches note reads of the wrapped storage and invalidates them on writes.
+// A failing backend only makes reads go to the wrapped storage.
+type Storage struct {
+	storage.Storage
+	backend   Backend
+	zapLogger *zap.SugaredLogger
+}
+
+func New(s storage.Storage, b Backend, l *zap.SugaredLogger) *Storage {
+	return &Storage{Storage: s, backend: b, zapLogger: l}
+}
+
+// Pages are keyed by a generation of the user's notes, a write starts a new one instead of finding the old pages.
+// A page read before the write is stored under the old generation and never served.
+func generationKey(userId int) string {
+	return fmt.Sprintf("kod:notes:%d:gen", userId)
+}
+
+func pageKey(userId int, generation string, offset, limit int) string {
+	return fmt.Sprintf("kod:notes:%d:%s:%d:%d", userId, generation, offset, limit)
+}
+
+func noteKey(noteId int) string {
+	return fmt.Sprintf("kod:note:%d", noteId)
+}
+
+// newGeneration is unique even when the previous one was evicted
+func newGeneration() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func (s *Storage) AddNote(ctx context.Context, note *models.Note) (models.Note, error) {
+	newNote, err := s.Storage.AddNote(ctx, note)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	// A new note shifts every page of its author
+	s.invalidatePages(ctx, newNote.UserId)
+	return newNote, nil
+}
+
+func (s *Storage) GetNotes(ctx context.Context, userId, offset, limit int) ([]models.Note, error) {
+	ctx, span := tracer.Start(ctx, "cache.GetNotes")
+	defer span.End()
+
+	generation, err := s.generation(ctx, userId)
+	if err != nil {
+		s.backendError(ctx, err)
+		return s.Storage.GetNotes(ctx, userId, offset, limit)
+	}
+
+	key := pageKey(userId, generation, offset, limit)
+	notes, ok := s.cachedPage(ctx, key)
+	lookups.Add(1)
+	span.SetAttributes(attribute.Bool("cache.hit", ok))
+	if ok {
+		hits.Add(1)
+		return notes, nil
+	}
+
+	notes, err = s.Storage.GetNotes(ctx, userId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	s.storePage(ctx, key, notes)
+	return notes, nil
+}
+
+func (s *Storage) DeleteUser(ctx context.Context, userId int) error {
+	if err := s.Storage.DeleteUser(ctx, userId); err != nil {
+		return err
+	}
+
+	// The cached notes themselves can't be reached without the pages and expire
+	s.invalidatePages(ctx, userId)
+	return nil
+}
+
+// generation returns the current generation of the user's pages, starting one if there is none
+func (s *Storage) generation(ctx context.Context, userId int) (string, error) {
+	value, ok, err := s.backend.Get(ctx, generationKey(userId))
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return string(value), nil
+	}
+
+	generation := newGeneration()
+	if err := s.backend.Set(ctx, generationKey(userId), []byte(generation)); err != nil {
+		return "", err
+	}
+	return generation, nil
+}
+
+// invalidatePages starts a new generation of the user's pages. If that can't be stored,
+// the generation is deleted instead, so the next read starts a new one: a Redis that is out of memory
+// still deletes keys, and a write the user can't see on the next read is worse than a cache miss.
+func (s *Storage) invalidatePages(ctx context.Context, userId int) {
+	err := s.backend.Set(ctx, generationKey(userId), []byte(newGeneration()))
+	if err == nil {
+		return
+	}
+	s.backendError(ctx, err)
+
+	if err := s.backend.Delete(ctx, generationKey(userId)); err != nil {
+		s.backendError(ctx, err)
+		util.LoggerFromContext(ctx, s.zapLogger).Errorf("storage cache: pages of user %d may be stale until they expire", userId)
+	}
+}
+
+// cachedPage reports a hit only if the page and all of its notes are cached
+func (s *Storage) cachedPage(ctx context.Context, key string) ([]models.Note, bool) {
+	value, ok, err := s.backend.Get(ctx, key)
+	if err != nil {
+		s.backendError(ctx, err)
+		return nil, false
+	}
+	var ids []int
+	if !ok || json.Unmarshal(value, &ids) != nil {
+		record("page", false)
+		return nil, false
+	}
+	record("page", true)
+	if len(ids) == 0 {
+		return nil, true
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = noteKey(id)
+	}
+	values, err := s.backend.GetMany(ctx, keys)
+	if err != nil {
+		s.backendError(ctx, err)
+		return nil, false
+	}
+
+	notes := make([]models.Note, len(ids))
+	hit := true
+	for i, value := range values {
+		if value == nil || json.Unmarshal(value, &notes[i]) != nil {
+			hit = false
+		}
+		record("note", value != nil)
+	}
+	return notes, hit
+}
+
+// storePage caches the page and its notes, except for the notes still waiting for their grammar check.
+// The check result is the only change a note ever sees, so a cached note is never stale:
+// deleting it when the check is written would race with a read that got the pending note before
+// and stores it afterwards. A page with a pending note is a miss until the check is done.
+func (s *Storage) storePage(ctx context.Context, key string, notes []models.Note) {
+	ids := make([]int, len(notes))
+	for i, note := range notes {
+		ids[i] = note.Id
+		if note.CheckStatus == models.CheckPending {
+			continue
+		}
+		value, err := json.Marshal(note)
+		if err != nil {
+			s.backendError(ctx, err)
+			return
+		}
+		if err := s.backend.Set(ctx, noteKey(note.Id), value); err != nil {
+			s.backendError(ctx, err)
+			return
+		}
+	}
+
+	value, err := json.Marshal(ids)
+	if err != nil {
+		s.backendError(ctx, err)
+		return
+	}
+	if err := s.backend.Set(ctx, key, value); err != nil {
+		s.backendError(ctx, err)
+	}
+}
+
+func (s *Storage) backendError(ctx context.Context, err error) {
+	requests.WithLabelValues("backend", "error").Inc()
+	util.LoggerFromContext(ctx, s.zapLogger).Warnf("storage cache: %v", err)
+}
+
+func record(kind string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	requests.WithLabelValues(kind, result).Inc()
+}
@@ -0,0 +1,227 @@
+package cached
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"kod/internal/models"
+	"kod/internal/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noteStorage keeps notes in memory and counts the reads that got past the cache
+type noteStorage struct {
+	storage.Storage
+	notes map[int][]models.Note
+	reads int
+}
+
+func newNoteStorage(notes ...models.Note) *noteStorage {
+	s := &noteStorage{notes: make(map[int][]models.Note)}
+	for _, note := range notes {
+		s.notes[note.UserId] = append(s.notes[note.UserId], note)
+	}
+	return s
+}
+
+func (s *noteStorage) AddNote(ctx context.Context, note *models.Note) (models.Note, error) {
+	newNote := *note
+	newNote.Id = 100 + len(s.notes[note.UserId])
+	s.notes[note.UserId] = append(s.notes[note.UserId], newNote)
+	return newNote, nil
+}
+
+func (s *noteStorage) GetNotes(ctx context.Context, userId, offset, limit int) ([]models.Note, error) {
+	s.reads++
+	notes := s.notes[userId]
+	if offset >= len(notes) {
+		return []models.Note{}, nil
+	}
+	return append([]models.Note(nil), notes[offset:min(offset+limit, len(notes))]...), nil
+}
+
+func (s *noteStorage) DeleteUser(ctx context.Context, userId int) error {
+	delete(s.notes, userId)
+	return nil
+}
+
+// faultyBackend fails the calls its switches are on for
+type faultyBackend struct {
+	Backend
+	failGet bool
+	failSet func(key string) bool
+}
+
+var errBackend = errors.New("backend is down")
+
+func (b *faultyBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if b.failGet {
+		return nil, false, errBackend
+	}
+	return b.Backend.Get(ctx, key)
+}
+
+func (b *faultyBackend) Set(ctx context.Context, key string, value []byte) error {
+	if b.failSet != nil && b.failSet(key) {
+		return errBackend
+	}
+	return b.Backend.Set(ctx, key, value)
+}
+
+// forEachBackend runs test against the memory backend and against Redis served by miniredis
+func forEachBackend(t *testing.T, test func(t *testing.T, b Backend)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory(100, time.Minute))
+	})
+	t.Run("redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		test(t, NewRedis(client, time.Minute))
+	})
+}
+
+func getNotes(t *testing.T, s *Storage, userId int) []models.Note {
+	t.Helper()
+	notes, err := s.GetNotes(context.Background(), userId, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notes
+}
+
+func checkNotes(t *testing.T, notes []models.Note, ids ...int) {
+	t.Helper()
+	if len(notes) != len(ids) {
+		t.Fatalf("got %d notes, want %d", len(notes), len(ids))
+	}
+	for i, id := range ids {
+		if notes[i].Id != id {
+			t.Errorf("note %d: id = %d, want %d", i, notes[i].Id, id)
+		}
+	}
+}
+
+func TestWritesStartNewGeneration(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		db := newNoteStorage(models.Note{Id: 1, UserId: 1, Title: "first", CheckStatus: models.CheckOk})
+		s := New(db, b, zap.NewNop().Sugar())
+
+		checkNotes(t, getNotes(t, s, 1), 1)
+		checkNotes(t, getNotes(t, s, 1), 1)
+		if db.reads != 1 {
+			t.Fatalf("page read %d times from storage, want 1", db.reads)
+		}
+
+		if _, err := s.AddNote(context.Background(), &models.Note{UserId: 1, Title: "second", CheckStatus: models.CheckOk}); err != nil {
+			t.Fatal(err)
+		}
+		checkNotes(t, getNotes(t, s, 1), 1, 101)
+
+		if err := s.DeleteUser(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		checkNotes(t, getNotes(t, s, 1))
+		if db.reads != 3 {
+			t.Errorf("page read %d times from storage, want 3", db.reads)
+		}
+	})
+}
+
+func TestPendingNotesAreNotCached(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		db := newNoteStorage(models.Note{Id: 1, UserId: 1, CheckStatus: models.CheckPending})
+		s := New(db, b, zap.NewNop().Sugar())
+
+		getNotes(t, s, 1)
+		getNotes(t, s, 1)
+		if db.reads != 2 {
+			t.Fatalf("page with a pending note read %d times from storage, want 2", db.reads)
+		}
+
+		// The grammar worker writes the result, the page is cached from the next read on
+		db.notes[1][0].CheckStatus = models.CheckIssues
+		if notes := getNotes(t, s, 1); notes[0].CheckStatus != models.CheckIssues {
+			t.Fatalf("check status = %s, want %s", notes[0].CheckStatus, models.CheckIssues)
+		}
+		getNotes(t, s, 1)
+		if db.reads != 3 {
+			t.Errorf("page read %d times from storage, want 3", db.reads)
+		}
+	})
+}
+
+func TestBackendErrorsFallThrough(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		tests := []struct {
+			name    string
+			backend *faultyBackend
+		}{
+			{"get", &faultyBackend{Backend: b, failGet: true}},
+			{"set", &faultyBackend{Backend: b, failSet: func(string) bool { return true }}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				db := newNoteStorage(models.Note{Id: 1, UserId: 1, CheckStatus: models.CheckOk})
+				s := New(db, tt.backend, zap.NewNop().Sugar())
+
+				checkNotes(t, getNotes(t, s, 1), 1)
+				checkNotes(t, getNotes(t, s, 1), 1)
+				if db.reads != 2 {
+					t.Errorf("page read %d times from storage, want 2", db.reads)
+				}
+			})
+		}
+	})
+}
+
+// TestInvalidationFallsBackToDelete checks that a new note is seen right away
+// even when the new generation can't be stored
+func TestInvalidationFallsBackToDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend) {
+		backend := &faultyBackend{Backend: b}
+		db := newNoteStorage(models.Note{Id: 1, UserId: 1, CheckStatus: models.CheckOk})
+		s := New(db, backend, zap.NewNop().Sugar())
+
+		checkNotes(t, getNotes(t, s, 1), 1)
+
+		backend.failSet = func(key string) bool { return key == generationKey(1) }
+		if _, err := s.AddNote(context.Background(), &models.Note{UserId: 1, CheckStatus: models.CheckOk}); err != nil {
+			t.Fatal(err)
+		}
+		backend.failSet = nil
+
+		checkNotes(t, getNotes(t, s, 1), 1, 101)
+		checkNotes(t, getNotes(t, s, 1), 1, 101)
+		if db.reads != 2 {
+			t.Errorf("page read %d times from storage, want 2", db.reads)
+		}
+	})
+}
+
+func TestHitRatio(t *testing.T) {
+	hits.Store(0)
+	lookups.Store(0)
+
+	db := newNoteStorage(models.Note{Id: 1, UserId: 1, CheckStatus: models.CheckOk})
+	s := New(db, NewMemory(100, time.Minute), zap.NewNop().Sugar())
+	for i := 0; i < 4; i++ {
+		getNotes(t, s, 1)
+	}
+
+	var m dto.Metric
+	if err := hitRatio.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetGauge().GetValue(); got != 0.75 {
+		t.Errorf("hit ratio = %v, want 0.75", got)
+	}
+	if !strings.Contains(hitRatio.Desc().String(), "kod_storage_cache_hit_ratio") {
+		t.Errorf("gauge is %s", hitRatio.Desc())
+	}
+}
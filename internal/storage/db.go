@@ -2,18 +2,151 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"kod/internal/models"
+	"time"
 )
 
+// ErrAlreadyExists is returned when a write violates a uniqueness constraint
+var ErrAlreadyExists = errors.New("already exists")
+
+// Unique constraints callers may need to tell apart
+const (
+	ConstraintUsername = "users_username_lower"
+	ConstraintEmail    = "users_email_lower"
+	ConstraintIdentity = "user_identities_provider_subject"
+)
+
+// ConstraintError is an ErrAlreadyExists naming the violated constraint
+type ConstraintError struct {
+	Constraint string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrAlreadyExists, e.Constraint)
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrAlreadyExists
+}
+
+// ViolatedConstraint returns the constraint named by a ConstraintError in err's chain
+func ViolatedConstraint(err error) string {
+	var ce *ConstraintError
+	if errors.As(err, &ce) {
+		return ce.Constraint
+	}
+	return ""
+}
+
 type Storage interface {
-	// AddNote adds a note to db
+	// AddNote adds a note to db, a pending note is queued for the grammar check
 	AddNote(ctx context.Context, note *models.Note) (models.Note, error)
 	// GetNotes returns list of notes, or ErrDoesNotExist
 	GetNotes(ctx context.Context, userId int, offset, limit int) ([]models.Note, error)
 	UserStorage
+	PasswordResetStorage
+	MfaStorage
+	AdminStorage
+	ApiTokenStorage
+	IdentityStorage
+	GrammarJobStorage
+	DictionaryStorage
 }
 
 type UserStorage interface {
+	// AddUser adds a user to db, or returns ErrAlreadyExists if the username is taken
 	AddUser(ctx context.Context, user *models.User) (models.User, error)
 	GetUser(ctx context.Context, userName string) (models.User, error)
-}
\ No newline at end of file
+	GetUserById(ctx context.Context, userId int) (models.User, error)
+	// GetUserByEmail returns the user whose verified email is email, unverified addresses aren't matched
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	// UpdatePassword sets a new password hash, bumps the session version and deletes the user's API tokens
+	UpdatePassword(ctx context.Context, userId int, hash string) (models.User, error)
+	// UpdateProfile stores email, its verification time, display name and timezone of user
+	UpdateProfile(ctx context.Context, user *models.User) (models.User, error)
+	// VerifyEmail marks email verified if it is still the user's email, or returns pgx.ErrNoRows.
+	// It fails with ConstraintEmail if another user has already verified the address.
+	VerifyEmail(ctx context.Context, userId int, email string) error
+	// DeleteUser removes a user, their notes are removed by cascade
+	DeleteUser(ctx context.Context, userId int) error
+}
+type PasswordResetStorage interface {
+	AddResetToken(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error
+	// ResetPassword consumes an unused, unexpired token and sets the password hash of its user
+	// bumping the session version and deleting their API tokens, or returns pgx.ErrNoRows
+	ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (models.User, error)
+}
+
+type MfaStorage interface {
+	// SetTotpSecret stores a secret pending confirmation, it can't be used while TOTP is enabled
+	SetTotpSecret(ctx context.Context, userId int, secret string) error
+	// EnableTotp turns TOTP on and replaces the recovery codes
+	EnableTotp(ctx context.Context, userId int, codeHashes []string) error
+	// DisableTotp removes the secret and recovery codes
+	DisableTotp(ctx context.Context, userId int) error
+	// UseTotpStep records the time step of an accepted code, or returns pgx.ErrNoRows
+	// if that step or a later one was already used
+	UseTotpStep(ctx context.Context, userId int, step int64) error
+	// UseRecoveryCode marks an unused recovery code used, or returns pgx.ErrNoRows
+	UseRecoveryCode(ctx context.Context, userId int, codeHash string) error
+	// StartMfaChallenge makes challengeId the user's only open login challenge
+	StartMfaChallenge(ctx context.Context, userId int, challengeId string) error
+	// UseMfaAttempt counts an answer to the open challenge, or returns pgx.ErrNoRows
+	// if challengeId isn't open or maxAttempts were already made
+	UseMfaAttempt(ctx context.Context, userId int, challengeId string, maxAttempts int) error
+	// EndMfaChallenge closes the open challenge after a correct answer, or returns pgx.ErrNoRows
+	// if it was closed already
+	EndMfaChallenge(ctx context.Context, userId int, challengeId string) error
+}
+
+type AdminStorage interface {
+	// ListUsers returns users whose username or email contains search, with their note counts
+	ListUsers(ctx context.Context, search string, offset, limit int) ([]models.UserSummary, error)
+	// GetUserSummary returns a user with their note count, or pgx.ErrNoRows
+	GetUserSummary(ctx context.Context, userId int) (models.UserSummary, error)
+	// SetUserDisabled disables or re-enables a user, or returns pgx.ErrNoRows
+	SetUserDisabled(ctx context.Context, userId int, disabled bool) error
+	// SetUserRole changes a user's role, or returns pgx.ErrNoRows
+	SetUserRole(ctx context.Context, userId int, role string) error
+	// RevokeSessions bumps the session version of a user and deletes their API tokens, or returns pgx.ErrNoRows
+	RevokeSessions(ctx context.Context, userId int) error
+}
+
+type ApiTokenStorage interface {
+	// AddApiToken stores a token under its secret's hash, or returns ErrAlreadyExists for a duplicate name
+	AddApiToken(ctx context.Context, token *models.ApiToken, tokenHash string) (models.ApiToken, error)
+	ListApiTokens(ctx context.Context, userId int) ([]models.ApiToken, error)
+	// DeleteApiToken removes a token of the user, or returns pgx.ErrNoRows
+	DeleteApiToken(ctx context.Context, userId, tokenId int) error
+	// UseApiToken finds an unexpired token by hash and records its use, or returns pgx.ErrNoRows
+	UseApiToken(ctx context.Context, tokenHash string) (models.ApiToken, error)
+}
+
+type IdentityStorage interface {
+	// GetUserByIdentity returns the user linked to provider's subject, or pgx.ErrNoRows
+	GetUserByIdentity(ctx context.Context, provider, subject string) (models.User, error)
+	// AddIdentity links an identity to an existing user, or returns ErrAlreadyExists if it is linked already
+	AddIdentity(ctx context.Context, identity *models.Identity) error
+	// AddUserWithIdentity creates a user together with their first identity
+	AddUserWithIdentity(ctx context.Context, user *models.User, identity *models.Identity) (models.User, error)
+}
+
+type GrammarJobStorage interface {
+	// ProcessGrammarJob leases the next due job for lease, skipping those leased by other workers,
+	// calls handle outside of any transaction and applies its outcome to the job and its note
+	// in a short transaction, unless the lease has run out. It reports false if no job is due.
+	ProcessGrammarJob(ctx context.Context, lease time.Duration, handle func(ctx context.Context, job *models.GrammarJob) models.GrammarJobOutcome) (bool, error)
+}
+
+// DictionaryStorage keeps the words of a user's dictionary, or of the organization's when userId is nil
+type DictionaryStorage interface {
+	ListDictionaryWords(ctx context.Context, userId *int) ([]models.DictionaryWord, error)
+	// AddDictionaryWord returns ErrAlreadyExists if the dictionary has the word in any case
+	AddDictionaryWord(ctx context.Context, userId *int, word string) (models.DictionaryWord, error)
+	// DeleteDictionaryWord removes a word of the dictionary, or returns pgx.ErrNoRows
+	DeleteDictionaryWord(ctx context.Context, userId *int, wordId int) error
+	// IgnoredWords returns the lowercased words of the user's and the organization's dictionaries
+	IgnoredWords(ctx context.Context, userId int) ([]string, error)
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+)
+
+const userSummaryQuery = `SELECT u.id, u.username, u.email, u.role, u.disabled_at, COALESCE(n.note_count, 0) AS note_count
+				FROM users u
+				LEFT JOIN (SELECT user_id, count(*) AS note_count FROM notes GROUP BY user_id) n ON n.user_id = u.id`
+
+func (d *Database) ListUsers(ctx context.Context, search string, offset, limit int) ([]models.UserSummary, error) {
+	const op = "storage.ListUsers"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	// search is matched literally, LIKE wildcards in it are escaped
+	query := userSummaryQuery + `
+				WHERE $1 = '' OR u.username LIKE '%' || $1 || '%' ESCAPE '\' OR lower(u.email) LIKE '%' || $1 || '%' ESCAPE '\'
+				ORDER BY u.id
+				LIMIT $3 OFFSET $2`
+
+	rows, err := d.Pool.Query(ctx, query, search, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	const op2 = op + "pgxscan"
+	var users []models.UserSummary
+	if err := pgxscan.ScanAll(&users, rows); err != nil {
+		return nil, fmt.Errorf("%s: %w", op2, err)
+	}
+	return users, nil
+}
+
+func (d *Database) GetUserSummary(ctx context.Context, userId int) (models.UserSummary, error) {
+	const op = "storage.GetUserSummary"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := userSummaryQuery + `
+				WHERE u.id = $1`
+
+	rows, err := d.Pool.Query(ctx, query, userId)
+	if err != nil {
+		return models.UserSummary{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	const op2 = op + "pgxscan"
+	var user models.UserSummary
+	if err := pgxscan.ScanOne(&user, rows); err != nil {
+		return models.UserSummary{}, fmt.Errorf("%s: %w", op2, err)
+	}
+	return user, nil
+}
+
+func (d *Database) SetUserDisabled(ctx context.Context, userId int, disabled bool) error {
+	const op = "storage.SetUserDisabled"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END
+				WHERE id = $1`
+
+	return d.execOne(ctx, op, query, userId, disabled)
+}
+
+func (d *Database) SetUserRole(ctx context.Context, userId int, role string) error {
+	const op = "storage.SetUserRole"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE users SET role = $2
+				WHERE id = $1`
+
+	return d.execOne(ctx, op, query, userId, role)
+}
+
+func (d *Database) RevokeSessions(ctx context.Context, userId int) error {
+	const op = "storage.RevokeSessions"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := revokeApiTokens + `UPDATE users SET session_version = session_version + 1
+				WHERE id = $1`
+
+	return d.execOne(ctx, op, query, userId)
+}
+
+// execOne runs a statement that must affect a row, or returns pgx.ErrNoRows
+func (d *Database) execOne(ctx context.Context, op, query string, args ...any) error {
+	tag, err := d.Pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, pgx.ErrNoRows)
+	}
+
+	return nil
+}
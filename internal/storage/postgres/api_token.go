@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"kod/internal/models"
+)
+
+const apiTokenColumns = `id, user_id, name, scope, expires_at, last_used_at, created_at`
+
+// revokeApiTokens deletes the API tokens of user $1 along with the statement it prefixes.
+// Every statement bumping session_version starts with it, so revoked sessions take the tokens with them.
+const revokeApiTokens = `WITH revoked_tokens AS (DELETE FROM api_tokens WHERE user_id = $1) `
+
+func (d *Database) AddApiToken(ctx context.Context, token *models.ApiToken, tokenHash string) (models.ApiToken, error) {
+	const op = "storage.AddApiToken"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `INSERT INTO api_tokens (user_id, name, token_hash, scope, expires_at)
+				VALUES ($1, $2, $3, $4, $5) returning ` + apiTokenColumns
+
+	rows, err := d.Pool.Query(ctx, query, token.UserId, token.Name, tokenHash, token.Scope, token.ExpiresAt)
+	if err != nil {
+		return models.ApiToken{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	const op2 = op + "pgxscan"
+	var newToken models.ApiToken
+	if err := pgxscan.ScanOne(&newToken, rows); err != nil {
+		return models.ApiToken{}, fmt.Errorf("%s: %w", op2, mapError(err))
+	}
+
+	return newToken, nil
+}
+
+func (d *Database) ListApiTokens(ctx context.Context, userId int) ([]models.ApiToken, error) {
+	const op = "storage.ListApiTokens"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens
+				WHERE user_id = $1
+				ORDER BY created_at DESC`
+
+	rows, err := d.Pool.Query(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	const op2 = op + "pgxscan"
+	var tokens []models.ApiToken
+	if err := pgxscan.ScanAll(&tokens, rows); err != nil {
+		return nil, fmt.Errorf("%s: %w", op2, err)
+	}
+	return tokens, nil
+}
+
+func (d *Database) DeleteApiToken(ctx context.Context, userId, tokenId int) error {
+	const op = "storage.DeleteApiToken"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`
+
+	return d.execOne(ctx, op, query, tokenId, userId)
+}
+
+func (d *Database) UseApiToken(ctx context.Context, tokenHash string) (models.ApiToken, error) {
+	const op = "storage.UseApiToken"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE api_tokens SET last_used_at = now()
+				WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > now())
+				returning ` + apiTokenColumns
+
+	rows, err := d.Pool.Query(ctx, query, tokenHash)
+	if err != nil {
+		return models.ApiToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	const op2 = op + "pgxscan"
+	var token models.ApiToken
+	if err := pgxscan.ScanOne(&token, rows); err != nil {
+		return models.ApiToken{}, fmt.Errorf("%s: %w", op2, err)
+	}
+
+	return token, nil
+}
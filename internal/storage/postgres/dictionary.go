@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"kod/internal/models"
+)
+
+const dictionaryColumns = `id, user_id, word, created_at`
+
+func (d *Database) ListDictionaryWords(ctx context.Context, userId *int) ([]models.DictionaryWord, error) {
+	const op = "storage.ListDictionaryWords"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `SELECT ` + dictionaryColumns + ` FROM dictionary_words
+				WHERE user_id IS NOT DISTINCT FROM $1
+				ORDER BY lower(word)`
+
+	rows, err := d.Pool.Query(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	const op2 = op + "pgxscan"
+	var words []models.DictionaryWord
+	if err := pgxscan.ScanAll(&words, rows); err != nil {
+		return nil, fmt.Errorf("%s: %w", op2, err)
+	}
+	return words, nil
+}
+
+func (d *Database) AddDictionaryWord(ctx context.Context, userId *int, word string) (models.DictionaryWord, error) {
+	const op = "storage.AddDictionaryWord"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `INSERT INTO dictionary_words (user_id, word)
+				VALUES ($1, $2) returning ` + dictionaryColumns
+
+	rows, err := d.Pool.Query(ctx, query, userId, word)
+	if err != nil {
+		return models.DictionaryWord{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	const op2 = op + "pgxscan"
+	var newWord models.DictionaryWord
+	if err := pgxscan.ScanOne(&newWord, rows); err != nil {
+		return models.DictionaryWord{}, fmt.Errorf("%s: %w", op2, mapError(err))
+	}
+
+	return newWord, nil
+}
+
+func (d *Database) DeleteDictionaryWord(ctx context.Context, userId *int, wordId int) error {
+	const op = "storage.DeleteDictionaryWord"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `DELETE FROM dictionary_words WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2`
+
+	return d.execOne(ctx, op, query, wordId, userId)
+}
+
+func (d *Database) IgnoredWords(ctx context.Context, userId int) ([]string, error) {
+	const op = "storage.IgnoredWords"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `SELECT lower(word) FROM dictionary_words WHERE user_id = $1 OR user_id IS NULL`
+
+	rows, err := d.Pool.Query(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	const op2 = op + "pgxscan"
+	var words []string
+	if err := pgxscan.ScanAll(&words, rows); err != nil {
+		return nil, fmt.Errorf("%s: %w", op2, err)
+	}
+	return words, nil
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+	"time"
+)
+
+// errLeaseExpired means another worker may have taken the job over, its outcome is dropped
+var errLeaseExpired = errors.New("job lease expired")
+
+func (d *Database) ProcessGrammarJob(ctx context.Context, lease time.Duration, handle func(ctx context.Context, job *models.GrammarJob) models.GrammarJobOutcome) (bool, error) {
+	const op = "storage.ProcessGrammarJob"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	// The claim commits right away, the lease rather than a row lock keeps other workers off the job.
+	// attempts counts claims, so a job whose worker died isn't retried forever,
+	// handle sees the attempts made before this one.
+	job := &models.GrammarJob{}
+	var lockedUntil time.Time
+	claim := `UPDATE grammar_jobs SET locked_until = now() + $1::interval, attempts = attempts + 1
+				WHERE id = (SELECT id FROM grammar_jobs
+					WHERE run_at <= now() AND (locked_until IS NULL OR locked_until < now())
+					ORDER BY run_at
+					LIMIT 1
+					FOR UPDATE SKIP LOCKED)
+				returning id, note_id, attempts - 1, locked_until`
+	if err := d.Pool.QueryRow(ctx, claim, lease).Scan(&job.Id, &job.Note.Id, &job.Attempts, &lockedUntil); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := d.Pool.Query(ctx, `SELECT `+noteColumns+` FROM notes WHERE id = $1`, job.Note.Id)
+	if err != nil {
+		return true, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := pgxscan.ScanOne(&job.Note, rows); err != nil {
+		// The note was deleted after the claim, its job went with it
+		if errors.Is(err, pgx.ErrNoRows) {
+			return true, nil
+		}
+		return true, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// No transaction is open while the speller is called
+	handleCtx, cancel := context.WithDeadline(ctx, lockedUntil)
+	outcome := handle(handleCtx, job)
+	cancel()
+
+	if outcome.Status == models.CheckPending {
+		retry := `UPDATE grammar_jobs SET run_at = $3, last_error = $4, locked_until = NULL
+				WHERE id = $1 AND locked_until = $2`
+		tag, err := d.Pool.Exec(ctx, retry, job.Id, lockedUntil, outcome.RetryAt, outcome.Error)
+		if err != nil {
+			return true, fmt.Errorf("%s: %w", op, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return true, fmt.Errorf("%s: job %d: %w", op, job.Id, errLeaseExpired)
+		}
+		return true, nil
+	}
+
+	err = pgx.BeginFunc(ctx, d.Pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM grammar_jobs WHERE id = $1 AND locked_until = $2`, job.Id, lockedUntil)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("job %d: %w", job.Id, errLeaseExpired)
+		}
+
+		finish := `UPDATE notes SET check_status = $2, check_issues = $3, unchecked = $4
+				WHERE id = $1`
+		_, err = tx.Exec(ctx, finish, job.Note.Id, outcome.Status, outcome.Issues, outcome.Status == models.CheckFailed)
+		return err
+	})
+	if err != nil {
+		return true, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"kod/internal/models"
+)
+
+func (d *Database) GetUserByIdentity(ctx context.Context, provider, subject string) (models.User, error) {
+	const op = "storage.GetUserByIdentity"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `SELECT ` + userColumns + ` FROM users
+				WHERE id = (SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2)`
+
+	rows, err := d.Pool.Query(ctx, query, provider, subject)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	const op2 = op + "pgxscan"
+	var user models.User
+	if err := pgxscan.ScanOne(&user, rows); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op2, err)
+	}
+
+	return user, nil
+}
+
+func (d *Database) AddIdentity(ctx context.Context, identity *models.Identity) error {
+	const op = "storage.AddIdentity"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	if err := addIdentity(ctx, d.Pool, identity); err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+func (d *Database) AddUserWithIdentity(ctx context.Context, user *models.User, identity *models.Identity) (models.User, error) {
+	const op = "storage.AddUserWithIdentity"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var newUser models.User
+	err := pgx.BeginFunc(ctx, d.Pool, func(tx pgx.Tx) error {
+		query := `INSERT INTO users (username, password, email, email_verified_at, display_name)
+				VALUES ($1, $2, $3, $4, $5) returning ` + userColumns
+		rows, err := tx.Query(ctx, query, user.Username, user.Password, user.Email, user.EmailVerifiedAt, user.DisplayName)
+		if err != nil {
+			return err
+		}
+		if err := pgxscan.ScanOne(&newUser, rows); err != nil {
+			return err
+		}
+
+		linked := *identity
+		linked.UserId = newUser.Id
+		return addIdentity(ctx, tx, &linked)
+	})
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return newUser, nil
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func addIdentity(ctx context.Context, db execer, identity *models.Identity) error {
+	query := `INSERT INTO user_identities (user_id, provider, subject, email)
+				VALUES ($1, $2, $3, $4)`
+
+	_, err := db.Exec(ctx, query, identity.UserId, identity.Provider, identity.Subject, identity.Email)
+	return err
+}
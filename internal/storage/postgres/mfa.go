@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+)
+
+func (d *Database) SetTotpSecret(ctx context.Context, userId int, secret string) error {
+	const op = "storage.SetTotpSecret"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE users SET totp_secret = $2
+				WHERE id = $1 AND NOT totp_enabled`
+
+	tag, err := d.Pool.Exec(ctx, query, userId, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (d *Database) EnableTotp(ctx context.Context, userId int, codeHashes []string) error {
+	const op = "storage.EnableTotp"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	err := pgx.BeginFunc(ctx, d.Pool, func(tx pgx.Tx) error {
+		enable := `UPDATE users SET totp_enabled = true
+				WHERE id = $1 AND totp_secret IS NOT NULL`
+		tag, err := tx.Exec(ctx, enable, userId)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userId, codeHashes)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (d *Database) DisableTotp(ctx context.Context, userId int) error {
+	const op = "storage.DisableTotp"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	err := pgx.BeginFunc(ctx, d.Pool, func(tx pgx.Tx) error {
+		disable := `UPDATE users SET totp_enabled = false, totp_secret = NULL, totp_last_step = 0
+				WHERE id = $1`
+		if _, err := tx.Exec(ctx, disable, userId); err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userId, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (d *Database) UseTotpStep(ctx context.Context, userId int, step int64) error {
+	const op = "storage.UseTotpStep"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE users SET totp_last_step = $2
+				WHERE id = $1 AND totp_last_step < $2`
+
+	tag, err := d.Pool.Exec(ctx, query, userId, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (d *Database) UseRecoveryCode(ctx context.Context, userId int, codeHash string) error {
+	const op = "storage.UseRecoveryCode"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE recovery_codes SET used_at = now()
+				WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	tag, err := d.Pool.Exec(ctx, query, userId, codeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (d *Database) StartMfaChallenge(ctx context.Context, userId int, challengeId string) error {
+	const op = "storage.StartMfaChallenge"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE users SET mfa_challenge = $2, mfa_attempts = 0
+				WHERE id = $1`
+
+	if _, err := d.Pool.Exec(ctx, query, userId, challengeId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (d *Database) UseMfaAttempt(ctx context.Context, userId int, challengeId string, maxAttempts int) error {
+	const op = "storage.UseMfaAttempt"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	// The attempt is counted before the code is checked, so parallel guesses can't exceed the limit
+	query := `UPDATE users SET mfa_attempts = mfa_attempts + 1
+				WHERE id = $1 AND mfa_challenge = $2 AND mfa_attempts < $3`
+
+	tag, err := d.Pool.Exec(ctx, query, userId, challengeId, maxAttempts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (d *Database) EndMfaChallenge(ctx context.Context, userId int, challengeId string) error {
+	const op = "storage.EndMfaChallenge"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE users SET mfa_challenge = NULL, mfa_attempts = 0
+				WHERE id = $1 AND mfa_challenge = $2`
+
+	tag, err := d.Pool.Exec(ctx, query, userId, challengeId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userId int, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	insert := `INSERT INTO recovery_codes (user_id, code_hash)
+				SELECT $1, unnest($2::text[])`
+	if len(codeHashes) > 0 {
+		if _, err := tx.Exec(ctx, insert, userId, codeHashes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+	"time"
+)
+
+func (d *Database) AddResetToken(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.AddResetToken"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+				VALUES ($1, $2, $3)`
+
+	if _, err := d.Pool.Exec(ctx, query, userId, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (d *Database) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (models.User, error) {
+	const op = "storage.ResetPassword"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var user models.User
+	err := pgx.BeginFunc(ctx, d.Pool, func(tx pgx.Tx) error {
+		var userId int
+		consume := `UPDATE password_reset_tokens SET used_at = now()
+				WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+				returning user_id`
+		if err := tx.QueryRow(ctx, consume, tokenHash).Scan(&userId); err != nil {
+			return err
+		}
+
+		// Other outstanding tokens of the user are void once the password changed
+		revoke := `UPDATE password_reset_tokens SET used_at = now()
+				WHERE user_id = $1 AND used_at IS NULL`
+		if _, err := tx.Exec(ctx, revoke, userId); err != nil {
+			return err
+		}
+
+		update := revokeApiTokens + `UPDATE users SET password = $2, session_version = session_version + 1
+				WHERE id = $1 returning ` + userColumns
+		rows, err := tx.Query(ctx, update, userId, passwordHash)
+		if err != nil {
+			return err
+		}
+		return pgxscan.ScanOne(&user, rows)
+	})
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
@@ -2,10 +2,13 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 	"kod/internal/models"
 	"kod/internal/models/config"
@@ -13,6 +16,15 @@ import (
 	"kod/internal/util"
 )
 
+const uniqueViolation = "23505"
+
+// userColumns are selected for every user read, the password hash only where it's needed
+const userColumns = `id, username, email, email_verified_at, display_name, timezone, language, totp_secret, totp_enabled, role, disabled_at, session_version`
+
+const noteColumns = `id, user_id, username, title, text, created_at, unchecked, check_status, check_issues, lang`
+
+var tracer = otel.Tracer("kod/internal/storage/postgres")
+
 type Database struct {
 	Pool      *pgxpool.Pool
 	zapLogger *zap.SugaredLogger
@@ -20,22 +32,22 @@ type Database struct {
 
 func (d *Database) AddUser(ctx context.Context, user *models.User) (models.User, error) {
 	const op = "storage.AddUser"
-	span, ctx := opentracing.StartSpanFromContext(ctx, op)
-	defer span.Finish()
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
 
-	query := `INSERT INTO users (username, password)
-				VALUES ($1, $2) returning id, username, password`
+	query := `INSERT INTO users (username, password, email)
+				VALUES ($1, $2, $3) returning ` + userColumns
 
-	rows, err := d.Pool.Query(ctx, query, user.Username, user.Password)
+	rows, err := d.Pool.Query(ctx, query, user.Username, user.Password, user.Email)
 	if err != nil {
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
 	const op2 = op + "pgxscan"
 	var newUser models.User
 	err = pgxscan.ScanOne(&newUser, rows)
 	if err != nil {
-		return models.User{}, fmt.Errorf("%s: %w", op2, err)
+		return models.User{}, fmt.Errorf("%s: %w", op2, mapError(err))
 	}
 
 	return newUser, nil
@@ -43,10 +55,10 @@ func (d *Database) AddUser(ctx context.Context, user *models.User) (models.User,
 
 func (d *Database) GetUser(ctx context.Context, userName string) (models.User, error) {
 	const op = "storage.GetUser"
-	span, ctx := opentracing.StartSpanFromContext(ctx, op)
-	defer span.Finish()
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
 
-	query := `SELECT id, username, password FROM users
+	query := `SELECT password, ` + userColumns + ` FROM users
 				WHERE username = $1`
 
 	rows, err := d.Pool.Query(ctx, query, userName)
@@ -64,39 +76,130 @@ func (d *Database) GetUser(ctx context.Context, userName string) (models.User, e
 	return newUser, nil
 }
 
-func (d *Database) AddNote(ctx context.Context, note *models.Note) (models.Note, error) {
-	const op = "storage.AddNote"
-	span, ctx := opentracing.StartSpanFromContext(ctx, op)
-	defer span.Finish()
+func (d *Database) GetUserById(ctx context.Context, userId int) (models.User, error) {
+	const op = "storage.GetUserById"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
 
-	query := `INSERT INTO notes (user_id, username, title, text, created_at)
-				VALUES ($1, $2, $3, $4, $5) returning id, user_id, username, title, text, created_at`
+	query := `SELECT password, ` + userColumns + ` FROM users
+				WHERE id = $1`
 
-	rows, err := d.Pool.Query(ctx, query, note.UserId, note.UserName, note.Title, note.Text, note.CreatedAt)
+	rows, err := d.Pool.Query(ctx, query, userId)
 	if err != nil {
-		return models.Note{}, fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	const op2 = op + "pgxscan"
-	var newNote models.Note
-	err = pgxscan.ScanOne(&newNote, rows)
+	var user models.User
+	err = pgxscan.ScanOne(&user, rows)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op2, err)
+	}
+
+	return user, nil
+}
+
+func (d *Database) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	const op = "storage.GetUserByEmail"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `SELECT password, ` + userColumns + ` FROM users
+				WHERE lower(email) = lower($1) AND email_verified_at IS NOT NULL`
+
+	rows, err := d.Pool.Query(ctx, query, email)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	const op2 = op + "pgxscan"
+	var user models.User
+	err = pgxscan.ScanOne(&user, rows)
 	if err != nil {
-		return models.Note{}, fmt.Errorf("%s: %w", op2, err)
+		return models.User{}, fmt.Errorf("%s: %w", op2, err)
 	}
 
-	//if err = d.cacheService.Put(note.Id, newNote); err != nil {
-	//	return models.Note{}, err
-	//}
+	return user, nil
+}
+
+func (d *Database) UpdatePassword(ctx context.Context, userId int, hash string) (models.User, error) {
+	const op = "storage.UpdatePassword"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := revokeApiTokens + `UPDATE users SET password = $2, session_version = session_version + 1
+				WHERE id = $1 returning ` + userColumns
+
+	rows, err := d.Pool.Query(ctx, query, userId, hash)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	const op2 = op + "pgxscan"
+	var user models.User
+	err = pgxscan.ScanOne(&user, rows)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op2, err)
+	}
+
+	return user, nil
+}
+
+func (d *Database) DeleteUser(ctx context.Context, userId int) error {
+	const op = "storage.DeleteUser"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `DELETE FROM users WHERE id = $1`
+
+	tag, err := d.Pool.Exec(ctx, query, userId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (d *Database) AddNote(ctx context.Context, note *models.Note) (models.Note, error) {
+	const op = "storage.AddNote"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	var newNote models.Note
+	err := pgx.BeginFunc(ctx, d.Pool, func(tx pgx.Tx) error {
+		query := `INSERT INTO notes (user_id, username, title, text, created_at, unchecked, check_status, check_issues, lang)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning ` + noteColumns
+		rows, err := tx.Query(ctx, query, note.UserId, note.UserName, note.Title, note.Text, note.CreatedAt,
+			note.Unchecked, note.CheckStatus, note.CheckIssues, note.Lang)
+		if err != nil {
+			return err
+		}
+		if err := pgxscan.ScanOne(&newNote, rows); err != nil {
+			return err
+		}
+
+		if newNote.CheckStatus != models.CheckPending {
+			return nil
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO grammar_jobs (note_id) VALUES ($1)`, newNote.Id)
+		return err
+	})
+	if err != nil {
+		return models.Note{}, fmt.Errorf("%s: %w", op, err)
+	}
 
 	return newNote, nil
 }
 
 func (d *Database) GetNotes(ctx context.Context, userId, offset, limit int) ([]models.Note, error) {
 	const op = "storage.GetNotes"
-	span, ctx := opentracing.StartSpanFromContext(ctx, op)
-	defer span.Finish()
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
 
-	query := `SELECT id, user_id, username, title, text, created_at
+	query := `SELECT ` + noteColumns + `
 				FROM notes
 				WHERE user_id=$1
 				ORDER BY created_at DESC
@@ -117,6 +220,15 @@ func (d *Database) GetNotes(ctx context.Context, userId, offset, limit int) ([]m
 	return notes, err
 }
 
+// mapError translates constraint violations to storage errors
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return &storage.ConstraintError{Constraint: pgErr.ConstraintName}
+	}
+	return err
+}
+
 func NewPostgresRepository(ctx context.Context, cfg *config.DbConfig, zap *zap.SugaredLogger) storage.Storage {
 	connStr := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=disable", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
 	var pool *pgxpool.Pool
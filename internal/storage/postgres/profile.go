@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"kod/internal/models"
+)
+
+func (d *Database) UpdateProfile(ctx context.Context, user *models.User) (models.User, error) {
+	const op = "storage.UpdateProfile"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE users SET email = $2, email_verified_at = $3, display_name = $4, timezone = $5, language = $6
+				WHERE id = $1 returning ` + userColumns
+
+	rows, err := d.Pool.Query(ctx, query, user.Id, user.Email, user.EmailVerifiedAt, user.DisplayName, user.Timezone, user.Language)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	const op2 = op + "pgxscan"
+	var updated models.User
+	err = pgxscan.ScanOne(&updated, rows)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op2, mapError(err))
+	}
+
+	return updated, nil
+}
+
+func (d *Database) VerifyEmail(ctx context.Context, userId int, email string) error {
+	const op = "storage.VerifyEmail"
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, now())
+				WHERE id = $1 AND lower(email) = lower($2)`
+
+	tag, err := d.Pool.Exec(ctx, query, userId, email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, pgx.ErrNoRows)
+	}
+
+	return nil
+}
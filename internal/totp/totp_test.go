@@ -0,0 +1,93 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of RFC 6238 Appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCodeRFC6238 checks the SHA-1 vectors of RFC 6238 Appendix B.
+// The RFC lists 8 digit codes, a 6 digit code is their last 6 digits.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("T=%d: code = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	tests := []struct {
+		offset int64
+		ok     bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	}
+	for _, tt := range tests {
+		step := Step(now) + tt.offset
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := Validate(rfcSecret, code, now)
+		if ok != tt.ok {
+			t.Errorf("step %+d: ok = %v, want %v", tt.offset, ok, tt.ok)
+		}
+		if ok && got != step {
+			t.Errorf("step %+d: matched step %d, want %d", tt.offset, got, step)
+		}
+	}
+}
+
+// TestValidateSameStep checks that a code entered twice within its step matches the same step,
+// which is what lets the caller accept it only once
+func TestValidateSameStep(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := Validate(rfcSecret, code, now)
+	if !ok {
+		t.Fatal("valid code rejected")
+	}
+	second, ok := Validate(rfcSecret, code, now.Add(10*time.Second))
+	if !ok || second != first {
+		t.Errorf("second use matched step %d (ok = %v), want %d", second, ok, first)
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870822", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := Validate(rfcSecret, "287 082", now); !ok {
+		t.Error("code with a space rejected")
+	}
+}
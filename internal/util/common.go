@@ -1,19 +1,24 @@
 package util
 
 import (
+	"errors"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io/fs"
+	"kod/internal/models"
 	"kod/internal/models/config"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// init loads ./.env if there is one, without it the variables come from the environment alone
 func init() {
 	err := godotenv.Load("./.env")
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Fatalf("err loading: %v", err)
 	}
 }
@@ -36,12 +41,428 @@ func NewSessionConfig() *config.SessionConfig {
 		log.Fatalf("Error parsing TIMEOUT: %v\n", err)
 	}
 
+	mfaTtl, err := time.ParseDuration(os.Getenv("MFA_TOKEN_TTL"))
+	if err != nil {
+		log.Fatalf("Error parsing MFA_TOKEN_TTL: %v\n", err)
+	}
+
+	transports := splitList(os.Getenv("AUTH_TRANSPORTS"), "cookie")
+	for _, t := range transports {
+		if t != "cookie" && t != "bearer" {
+			log.Fatalf("Error parsing AUTH_TRANSPORTS: unknown transport %q\n", t)
+		}
+	}
+
+	// By default the app itself and the CORS origins of browser front-ends are trusted
+	origins := splitList(os.Getenv("CSRF_TRUSTED_ORIGINS"), os.Getenv("APP_BASE_URL")+","+os.Getenv("CORS_ALLOWED_ORIGINS"))
+	for i, o := range origins {
+		origins[i] = strings.TrimSuffix(o, "/")
+	}
+
 	return &config.SessionConfig{
-		CookieTTL:  cookieTtl,
-		CookieName: os.Getenv("COOKIE_NAME"),
-		JwtTTL:     jwtTtl,
-		JwtSecret:  os.Getenv("JWT_SECRET"),
+		CookieTTL:      cookieTtl,
+		CookieName:     os.Getenv("COOKIE_NAME"),
+		JwtTTL:         jwtTtl,
+		JwtSecret:      os.Getenv("JWT_SECRET"),
+		MfaTokenTTL:    mfaTtl,
+		AuthTransports: transports,
+		TrustedOrigins: origins,
+	}
+}
+
+func NewTelemetryConfig() *config.TelemetryConfig {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "kod"
+	}
+	// The endpoint's scheme picks the transport, this only forces plain HTTP for an endpoint without one
+	insecure := false
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_INSECURE"); v != "" {
+		var err error
+		insecure, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("err parsing OTEL_EXPORTER_OTLP_INSECURE: %v\n", err)
+		}
+	}
+	ratio := 1.0
+	if v := os.Getenv("OTEL_TRACES_SAMPLER_RATIO"); v != "" {
+		var err error
+		ratio, err = strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			log.Fatalf("err parsing OTEL_TRACES_SAMPLER_RATIO: %q must be in [0, 1]\n", v)
+		}
+	}
+
+	return &config.TelemetryConfig{
+		ServiceName:   serviceName,
+		OtlpEndpoint:  os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OtlpInsecure:  insecure,
+		SamplingRatio: ratio,
+	}
+}
+
+func NewMailConfig() *config.MailConfig {
+	startTLS := false
+	if v := os.Getenv("SMTP_STARTTLS"); v != "" {
+		var err error
+		startTLS, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("err parsing SMTP_STARTTLS: %v\n", err)
+		}
+	}
+
+	return &config.MailConfig{
+		Driver:   os.Getenv("MAIL_DRIVER"),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		StartTLS: startTLS,
+		From:     os.Getenv("MAIL_FROM"),
+	}
+}
+
+func NewDictionaryConfig() *config.DictionaryConfig {
+	return &config.DictionaryConfig{
+		File: os.Getenv("DICTIONARY_FILE"),
+	}
+}
+
+func NewAccountConfig() *config.AccountConfig {
+	resetTtl, err := time.ParseDuration(os.Getenv("RESET_TOKEN_TTL"))
+	if err != nil {
+		log.Fatalf("Error parsing RESET_TOKEN_TTL: %v\n", err)
+	}
+
+	verifyTtl, err := time.ParseDuration(os.Getenv("VERIFY_EMAIL_TTL"))
+	if err != nil {
+		log.Fatalf("Error parsing VERIFY_EMAIL_TTL: %v\n", err)
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "kod"
+	}
+
+	return &config.AccountConfig{
+		BaseURL:        os.Getenv("APP_BASE_URL"),
+		ResetTokenTTL:  resetTtl,
+		VerifyEmailTTL: verifyTtl,
+		TotpIssuer:     issuer,
+	}
+}
+
+func NewCorsConfig() *config.CorsConfig {
+	credentials := true
+	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		var err error
+		credentials, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Error parsing CORS_ALLOW_CREDENTIALS: %v\n", err)
+		}
+	}
+	maxAge := 10 * time.Minute
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		var err error
+		maxAge, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Error parsing CORS_MAX_AGE: %v\n", err)
+		}
+	}
+
+	origins := splitList(os.Getenv("CORS_ALLOWED_ORIGINS"), "")
+	for i, o := range origins {
+		origins[i] = strings.TrimSuffix(o, "/")
+		if o == "*" && credentials {
+			log.Fatalf("Error parsing CORS_ALLOWED_ORIGINS: \"*\" can't be used with CORS_ALLOW_CREDENTIALS\n")
+		}
+	}
+
+	return &config.CorsConfig{
+		AllowedOrigins:   origins,
+		AllowedMethods:   splitList(strings.ToUpper(os.Getenv("CORS_ALLOWED_METHODS")), "GET,POST,PUT,PATCH,DELETE"),
+		AllowedHeaders:   splitList(os.Getenv("CORS_ALLOWED_HEADERS"), "Content-Type,Authorization,X-CSRF-Token,X-Request-ID"),
+		ExposedHeaders:   splitList(os.Getenv("CORS_EXPOSED_HEADERS"), "Location,Retry-After,X-Request-ID,X-Trace-Id,X-CSRF-Token"),
+		AllowCredentials: credentials,
+		MaxAge:           maxAge,
+	}
+}
+
+// splitList splits a comma separated env value, falling back to def when it is empty
+func splitList(v, def string) []string {
+	if strings.TrimSpace(v) == "" {
+		v = def
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func NewOidcConfig() *config.OidcConfig {
+	stateTtl := 10 * time.Minute
+	if v := os.Getenv("OIDC_STATE_TTL"); v != "" {
+		var err error
+		stateTtl, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Error parsing OIDC_STATE_TTL: %v\n", err)
+		}
+	}
+	baseURL := strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/")
+
+	var providers []config.OidcProvider
+	for _, name := range splitList(strings.ToLower(os.Getenv("OIDC_PROVIDERS")), "") {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := config.OidcProvider{
+			Name:          name,
+			Issuer:        os.Getenv(prefix + "ISSUER"),
+			ClientId:      os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:  os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:        splitList(os.Getenv(prefix+"SCOPES"), "openid,email,profile"),
+			RedirectURL:   os.Getenv(prefix + "REDIRECT_URL"),
+			AutoProvision: true,
+		}
+		if provider.Issuer == "" || provider.ClientId == "" {
+			log.Fatalf("Error parsing OIDC_PROVIDERS: %sISSUER and %sCLIENT_ID are required\n", prefix, prefix)
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = baseURL + "/auth/oidc/" + name + "/callback"
+		}
+		if v := os.Getenv(prefix + "AUTO_PROVISION"); v != "" {
+			var err error
+			provider.AutoProvision, err = strconv.ParseBool(v)
+			if err != nil {
+				log.Fatalf("Error parsing %sAUTO_PROVISION: %v\n", prefix, err)
+			}
+		}
+		if v := os.Getenv(prefix + "LINK_BY_EMAIL"); v != "" {
+			var err error
+			provider.LinkByEmail, err = strconv.ParseBool(v)
+			if err != nil {
+				log.Fatalf("Error parsing %sLINK_BY_EMAIL: %v\n", prefix, err)
+			}
+		}
+		providers = append(providers, provider)
+	}
+
+	postLogin := os.Getenv("OIDC_POST_LOGIN_URL")
+	if postLogin == "" {
+		postLogin = baseURL + "/"
 	}
+
+	mfa := os.Getenv("OIDC_MFA_URL")
+	if mfa == "" {
+		mfa = postLogin
+	}
+
+	return &config.OidcConfig{
+		Providers:    providers,
+		StateTTL:     stateTtl,
+		PostLoginURL: postLogin,
+		MfaURL:       mfa,
+	}
+}
+
+func NewValidationConfig() *config.ValidationConfig {
+	cfg := &config.ValidationConfig{
+		Validators:     splitList(os.Getenv("NOTE_VALIDATORS"), "length,spell"),
+		Policy:         make(map[string]string),
+		TitleMaxLength: 200,
+		TextMinLength:  1,
+		TextMaxLength:  10000,
+		ProfanityFiles: splitList(os.Getenv("NOTE_PROFANITY_FILES"), ""),
+		LinkAllowlist:  splitList(os.Getenv("NOTE_LINK_ALLOWLIST"), ""),
+	}
+
+	known := map[string]bool{
+		config.ValidatorLength:    true,
+		config.ValidatorSpell:     true,
+		config.ValidatorProfanity: true,
+		config.ValidatorLinks:     true,
+		config.ValidatorSecrets:   true,
+	}
+	for _, v := range cfg.Validators {
+		if !known[v] {
+			log.Fatalf("Error parsing NOTE_VALIDATORS: unknown validator %q\n", v)
+		}
+	}
+	for _, rule := range splitList(os.Getenv("NOTE_POLICY"), "") {
+		validator, action, _ := strings.Cut(rule, "=")
+		validator, action = strings.TrimSpace(validator), strings.TrimSpace(action)
+		if !known[validator] {
+			log.Fatalf("Error parsing NOTE_POLICY: unknown validator %q\n", validator)
+		}
+		if action != models.ActionBlock && action != models.ActionWarn && action != models.ActionRedact {
+			log.Fatalf("Error parsing NOTE_POLICY: action of %s must be block, warn or redact\n", validator)
+		}
+		cfg.Policy[validator] = action
+	}
+	for i, d := range cfg.LinkAllowlist {
+		cfg.LinkAllowlist[i] = strings.ToLower(strings.TrimPrefix(d, "."))
+	}
+
+	ints := map[string]*int{
+		"NOTE_TITLE_MAX_LENGTH": &cfg.TitleMaxLength,
+		"NOTE_TEXT_MIN_LENGTH":  &cfg.TextMinLength,
+		"NOTE_TEXT_MAX_LENGTH":  &cfg.TextMaxLength,
+	}
+	for name, n := range ints {
+		if v := os.Getenv(name); v != "" {
+			var err error
+			*n, err = strconv.Atoi(v)
+			if err != nil || *n < 0 {
+				log.Fatalf("Error parsing %s: %q must be a non-negative number\n", name, v)
+			}
+		}
+	}
+
+	return cfg
+}
+
+func NewStorageCacheConfig() *config.StorageCacheConfig {
+	cfg := &config.StorageCacheConfig{
+		Backend:       os.Getenv("STORAGE_CACHE"),
+		Size:          10000,
+		TTL:           5 * time.Minute,
+		RedisAddr:     os.Getenv("REDIS_ADDR"),
+		RedisPassword: os.Getenv("REDIS_PASSWORD"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = config.CacheNone
+	}
+	if cfg.Backend != config.CacheNone && cfg.Backend != config.CacheMemory && cfg.Backend != config.CacheRedis {
+		log.Fatalf("Error parsing STORAGE_CACHE: %q must be %q, %q or %q\n", cfg.Backend, config.CacheNone, config.CacheMemory, config.CacheRedis)
+	}
+	if cfg.RedisAddr == "" {
+		cfg.RedisAddr = "localhost:6379"
+	}
+
+	if v := os.Getenv("STORAGE_CACHE_TTL"); v != "" {
+		var err error
+		cfg.TTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Error parsing STORAGE_CACHE_TTL: %v\n", err)
+		}
+	}
+	ints := map[string]*int{
+		"STORAGE_CACHE_SIZE": &cfg.Size,
+		"REDIS_DB":           &cfg.RedisDB,
+	}
+	for name, n := range ints {
+		if v := os.Getenv(name); v != "" {
+			var err error
+			*n, err = strconv.Atoi(v)
+			if err != nil || *n < 0 {
+				log.Fatalf("Error parsing %s: %q must be a non-negative number\n", name, v)
+			}
+		}
+	}
+
+	return cfg
+}
+
+func NewSpellerConfig() *config.SpellerConfig {
+	cfg := &config.SpellerConfig{
+		URL:              strings.TrimSuffix(os.Getenv("SPELLER_URL"), "/"),
+		ConnectTimeout:   time.Second,
+		Timeout:          5 * time.Second,
+		MaxRetries:       2,
+		RetryBackoff:     200 * time.Millisecond,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		FailurePolicy:    os.Getenv("SPELLER_FAILURE_POLICY"),
+		IgnoreURLs:       true,
+		CacheSize:        10000,
+		CacheTTL:         time.Hour,
+		CheckMode:        os.Getenv("GRAMMAR_CHECK_MODE"),
+		Workers:          2,
+		PollInterval:     time.Second,
+		JobMaxAttempts:   5,
+		JobBackoff:       10 * time.Second,
+		JobLease:         time.Minute,
+	}
+	if cfg.URL == "" {
+		cfg.URL = "https://speller.yandex.net/services/spellservice.json"
+	}
+	if cfg.FailurePolicy == "" {
+		cfg.FailurePolicy = config.FailClosed
+	}
+	if cfg.CheckMode == "" {
+		cfg.CheckMode = config.CheckSync
+	}
+	if cfg.CheckMode != config.CheckSync && cfg.CheckMode != config.CheckAsync {
+		log.Fatalf("Error parsing GRAMMAR_CHECK_MODE: %q must be %q or %q\n", cfg.CheckMode, config.CheckSync, config.CheckAsync)
+	}
+	if cfg.FailurePolicy != config.FailClosed && cfg.FailurePolicy != config.FailOpen {
+		log.Fatalf("Error parsing SPELLER_FAILURE_POLICY: %q must be %q or %q\n", cfg.FailurePolicy, config.FailClosed, config.FailOpen)
+	}
+
+	durations := map[string]*time.Duration{
+		"SPELLER_CONNECT_TIMEOUT":  &cfg.ConnectTimeout,
+		"SPELLER_TIMEOUT":          &cfg.Timeout,
+		"SPELLER_RETRY_BACKOFF":    &cfg.RetryBackoff,
+		"SPELLER_BREAKER_COOLDOWN": &cfg.BreakerCooldown,
+		"SPELLER_CACHE_TTL":        &cfg.CacheTTL,
+		"GRAMMAR_POLL_INTERVAL":    &cfg.PollInterval,
+		"GRAMMAR_JOB_BACKOFF":      &cfg.JobBackoff,
+		"GRAMMAR_JOB_LEASE":        &cfg.JobLease,
+	}
+	for name, d := range durations {
+		if v := os.Getenv(name); v != "" {
+			var err error
+			*d, err = time.ParseDuration(v)
+			if err != nil {
+				log.Fatalf("Error parsing %s: %v\n", name, err)
+			}
+		}
+	}
+
+	ints := map[string]*int{
+		"SPELLER_MAX_RETRIES":       &cfg.MaxRetries,
+		"SPELLER_BREAKER_THRESHOLD": &cfg.BreakerThreshold,
+		"SPELLER_CACHE_SIZE":        &cfg.CacheSize,
+		"GRAMMAR_WORKERS":           &cfg.Workers,
+		"GRAMMAR_JOB_MAX_ATTEMPTS":  &cfg.JobMaxAttempts,
+	}
+	for name, n := range ints {
+		if v := os.Getenv(name); v != "" {
+			var err error
+			*n, err = strconv.Atoi(v)
+			if err != nil || *n < 0 {
+				log.Fatalf("Error parsing %s: %q must be a non-negative number\n", name, v)
+			}
+		}
+	}
+	bools := map[string]*bool{
+		"SPELLER_IGNORE_DIGITS":         &cfg.IgnoreDigits,
+		"SPELLER_IGNORE_URLS":           &cfg.IgnoreURLs,
+		"SPELLER_IGNORE_CAPITALIZATION": &cfg.IgnoreCapitalization,
+		"SPELLER_CACHE_PARAGRAPHS":      &cfg.CacheParagraphs,
+		"SPELLER_OFFLINE_FALLBACK":      &cfg.OfflineFallback,
+	}
+	for name, b := range bools {
+		if v := os.Getenv(name); v != "" {
+			var err error
+			*b, err = strconv.ParseBool(v)
+			if err != nil {
+				log.Fatalf("Error parsing %s: %v\n", name, err)
+			}
+		}
+	}
+	if cfg.BreakerThreshold == 0 {
+		log.Fatalf("Error parsing SPELLER_BREAKER_THRESHOLD: must be at least 1\n")
+	}
+	if cfg.CheckMode == config.CheckAsync && (cfg.Workers == 0 || cfg.JobMaxAttempts == 0) {
+		log.Fatalf("Error parsing GRAMMAR_WORKERS, GRAMMAR_JOB_MAX_ATTEMPTS: must be at least 1\n")
+	}
+	if cfg.CheckMode == config.CheckAsync && cfg.JobLease <= cfg.Timeout {
+		log.Fatalf("Error parsing GRAMMAR_JOB_LEASE: must be longer than SPELLER_TIMEOUT\n")
+	}
+
+	return cfg
 }
 
 func NewDbConfig() *config.DbConfig {
@@ -65,19 +486,53 @@ func NewDbConfig() *config.DbConfig {
 	}
 }
 
-func NewZapLogger() *zap.SugaredLogger {
+func NewLogConfig() *config.LogConfig {
+	level := os.Getenv("LOG_LEVEL")
+	if level == "" {
+		level = "info"
+	}
+	format := os.Getenv("LOG_FORMAT")
+	if format == "" {
+		format = "console"
+	}
+
+	return &config.LogConfig{
+		Level:  level,
+		Format: format,
+	}
+}
+
+// NewZapLogger writes errors to stderr and everything else to stdout.
+// Format "json" uses the production encoder, "console" the development one.
+func NewZapLogger(cfg *config.LogConfig) *zap.SugaredLogger {
+	minLevel, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		log.Fatalf("err parsing LOG_LEVEL: %v\n", err)
+	}
+
+	var encoder zapcore.Encoder
+	switch cfg.Format {
+	case "json":
+		encoderCfg := zap.NewProductionEncoderConfig()
+		encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	case "console":
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	default:
+		log.Fatalf("unknown LOG_FORMAT: %q\n", cfg.Format)
+	}
+
 	highPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= zapcore.ErrorLevel
+		return lvl >= zapcore.ErrorLevel && lvl >= minLevel
 	})
 	lowPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl < zapcore.ErrorLevel
+		return lvl < zapcore.ErrorLevel && lvl >= minLevel
 	})
 	consoleDebugging := zapcore.Lock(os.Stdout)
 	consoleErrors := zapcore.Lock(os.Stderr)
-	consoleEncoder := zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
 	core := zapcore.NewTee(
-		zapcore.NewCore(consoleEncoder, consoleErrors, highPriority),
-		zapcore.NewCore(consoleEncoder, consoleDebugging, lowPriority),
+		zapcore.NewCore(encoder, consoleErrors, highPriority),
+		zapcore.NewCore(encoder, consoleDebugging, lowPriority),
 	)
 	logger := zap.New(core, zap.AddStacktrace(zap.ErrorLevel))
 	sugar := logger.Sugar()
@@ -68,12 +68,17 @@ func DecodeJSONBody(r *http.Request, dst interface{}) error {
 }
 
 func WriteJSON(w http.ResponseWriter, v any) {
-	w.Header().Set("Content-Type", "aplication/json")
+	WriteJSONStatus(w, http.StatusOK, v)
+}
+
+func WriteJSONStatus(w http.ResponseWriter, status int, v any) {
 	b, err := json.Marshal(v)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(b)
 }
\ No newline at end of file
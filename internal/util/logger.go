@@ -0,0 +1,54 @@
+package util
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+)
+
+type loggerKey struct{}
+
+type requestIdKey struct{}
+
+// loggerHolder is shared by every handler in a request chain,
+// so fields added by inner middleware are visible to outer ones.
+type loggerHolder struct {
+	mu     sync.Mutex
+	logger *zap.SugaredLogger
+}
+
+// WithLogger stores a request-scoped logger in ctx
+func WithLogger(ctx context.Context, l *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, &loggerHolder{logger: l})
+}
+
+// AddLogFields enriches the request-scoped logger in ctx with key-value pairs
+func AddLogFields(ctx context.Context, keysAndValues ...interface{}) {
+	h, ok := ctx.Value(loggerKey{}).(*loggerHolder)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	h.logger = h.logger.With(keysAndValues...)
+	h.mu.Unlock()
+}
+
+// LoggerFromContext returns the request-scoped logger, or fallback if there is none
+func LoggerFromContext(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	h, ok := ctx.Value(loggerKey{}).(*loggerHolder)
+	if !ok {
+		return fallback
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.logger
+}
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
@@ -0,0 +1,15 @@
+package util
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceFields returns zap key-value pairs identifying the active span, if any
+func TraceFields(ctx context.Context) []interface{} {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []interface{}{"trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String()}
+}
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT user_identities_provider_subject UNIQUE (provider, subject)
+);
+CREATE INDEX user_identities_user_id ON user_identities USING hash(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS user_identities_user_id;
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
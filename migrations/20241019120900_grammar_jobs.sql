@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS check_status TEXT NOT NULL DEFAULT 'ok'
+    CHECK (check_status IN ('pending', 'ok', 'issues', 'failed'));
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS check_issues JSONB;
+UPDATE notes SET check_status = 'failed' WHERE unchecked;
+
+CREATE TABLE IF NOT EXISTS grammar_jobs (
+    id SERIAL PRIMARY KEY,
+    note_id INTEGER UNIQUE NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    run_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    last_error TEXT,
+    -- A claimed job belongs to its worker until then, an expired lease is claimed again
+    locked_until timestamp with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX grammar_jobs_run_at ON grammar_jobs (run_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS grammar_jobs_run_at;
+DROP TABLE IF EXISTS grammar_jobs;
+ALTER TABLE notes DROP COLUMN IF EXISTS check_issues;
+ALTER TABLE notes DROP COLUMN IF EXISTS check_status;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Words with no user_id form the organization-wide dictionary
+CREATE TABLE IF NOT EXISTS dictionary_words (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    word TEXT NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS dictionary_words_user_word ON dictionary_words (user_id, lower(word)) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS dictionary_words_org_word ON dictionary_words (lower(word)) WHERE user_id IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS dictionary_words;
+-- +goose StatementEnd
@@ -2,20 +2,21 @@ package telemetry
 
 import (
 	"context"
-	"github.com/opentracing/opentracing-go"
+	"fmt"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	log "github.com/sirupsen/logrus"
-	"github.com/uber/jaeger-client-go"
-	traceconfig "github.com/uber/jaeger-client-go/config"
-	"github.com/uber/jaeger-lib/metrics/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
+	"kod/internal/models/config"
 	"net/http"
-	"sync"
 )
 
 func Listen(ctx context.Context, zap *zap.SugaredLogger, telemetryAddr string) {
-	MustSetup(ctx, "kod")
-
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
 
@@ -25,37 +26,43 @@ func Listen(ctx context.Context, zap *zap.SugaredLogger, telemetryAddr string) {
 	}
 }
 
-func MustSetup(ctx context.Context, serviceName string) {
-	cfg := traceconfig.Configuration{
-		ServiceName: serviceName,
-		Sampler: &traceconfig.SamplerConfig{
-			Type:  "const",
-			Param: 1,
-		},
-		Reporter: &traceconfig.ReporterConfig{
-			CollectorEndpoint: "http://localhost:14268/api/traces",
-			LogSpans:          true,
-		},
+// Setup installs the global tracer provider and W3C propagators.
+// Without a configured collector endpoint a no-op tracer is used.
+// The returned func flushes and stops the exporter.
+func Setup(ctx context.Context, cfg *config.TelemetryConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.OtlpEndpoint == "" {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(cfg.OtlpEndpoint)}
+	if cfg.OtlpInsecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry.Setup: otlp exporter: %w", err)
 	}
 
-	tracer, closer, err := cfg.NewTracer(traceconfig.Logger(jaeger.StdLogger), traceconfig.Metrics(prometheus.New()))
+	resource, err := sdkresource.Merge(sdkresource.Default(), sdkresource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
 	if err != nil {
-		log.Fatalf("ERROR: cannot init Jaeger %s", err)
+		return nil, fmt.Errorf("telemetry.Setup: resource: %w", err)
 	}
 
-	go func() {
-		onceCloser := sync.OnceFunc(func() {
-			log.Warn(ctx, "closing tracer")
-			if err = closer.Close(); err != nil {
-				log.Errorf("error closing tracer: %s", err)
-			}
-		})
-
-		for {
-			<-ctx.Done()
-			onceCloser()
-		}
-	}()
-
-	opentracing.SetGlobalTracer(tracer)
-}
\ No newline at end of file
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplingRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}